@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ACED-IDP/gecko/gecko/settings"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: gecko config print [flags]
+
+Print the settings gecko would run with, given the same config file,
+environment variables and flags, as YAML that can be used as a config file.
+The database password is replaced by xxxxx.
+
+flags:
+`
+
+func runConfig(args []string) {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), configUsage)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "print" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	config, err := settings.Load(flags, args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if config.ConfigFile != "" {
+		fmt.Printf("# settings read from %s\n", config.ConfigFile)
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	_ = encoder.Encode(config.Redacted())
+}
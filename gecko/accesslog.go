@@ -0,0 +1,194 @@
+package gecko
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// The formats an AccessLog can write.
+const (
+	AccessLogFormatCommon = "common"
+	AccessLogFormatJSON   = "json"
+)
+
+// AccessLog writes one line per request, either in Common Log Format or as a
+// JSON object. It is safe for concurrent use.
+type AccessLog struct {
+	mu             sync.Mutex
+	out            io.Writer
+	format         string
+	trustedProxies []netip.Prefix
+	skippedPaths   map[string]bool
+}
+
+// AccessLogEntry is a request as written to a JSON access log.
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latencyMs"`
+	Bytes     int       `json:"bytes"`
+	ClientIP  string    `json:"clientIp"`
+	Subject   string    `json:"subject,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+func NewAccessLog(out io.Writer, format string) (*AccessLog, error) {
+	if format != AccessLogFormatCommon && format != AccessLogFormatJSON {
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	return &AccessLog{out: out, format: format, skippedPaths: map[string]bool{}}, nil
+}
+
+// WithTrustedProxies makes the log take the client IP from X-Forwarded-For
+// when a request comes from one of the given networks: the client is the
+// right-most address in the header that is not a trusted proxy. Otherwise the
+// header is ignored, since anyone can set it.
+func (accessLog *AccessLog) WithTrustedProxies(proxies []netip.Prefix) *AccessLog {
+	accessLog.trustedProxies = proxies
+	return accessLog
+}
+
+// WithSkippedPaths leaves requests for the given paths, such as `/health`, out
+// of the log.
+func (accessLog *AccessLog) WithSkippedPaths(paths ...string) *AccessLog {
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path != "" {
+			accessLog.skippedPaths[path] = true
+		}
+	}
+	return accessLog
+}
+
+// ParseTrustedProxies reads a comma-separated list of IP addresses and CIDR
+// networks.
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	proxies := []netip.Prefix{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// middleware logs the request once the rest of the chain has handled it.
+func (accessLog *AccessLog) middleware(ctx iris.Context) {
+	start := time.Now()
+	ctx.Next()
+	request := ctx.Request()
+	if accessLog.skippedPaths[request.URL.Path] {
+		return
+	}
+	entry := AccessLogEntry{
+		Time:      start,
+		Method:    request.Method,
+		Path:      request.URL.Path,
+		Route:     routeName(ctx),
+		Status:    ctx.GetStatusCode(),
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Bytes:     max(ctx.ResponseWriter().Written(), 0),
+		ClientIP:  clientIP(request.RemoteAddr, request.Header.Values("X-Forwarded-For"), accessLog.trustedProxies),
+		RequestID: RequestIDFrom(request.Context()),
+	}
+	if info := tokenInfoFrom(ctx); info != nil {
+		entry.Subject = info.subject
+	}
+	var line []byte
+	if accessLog.format == AccessLogFormatJSON {
+		var err error
+		line, err = json.Marshal(entry)
+		if err != nil {
+			return
+		}
+	} else {
+		line = []byte(commonLogLine(entry, request.RequestURI, request.Proto))
+	}
+	accessLog.mu.Lock()
+	defer accessLog.mu.Unlock()
+	_, _ = accessLog.out.Write(append(line, '\n'))
+}
+
+// clientIP returns the address a request came from, looking through the
+// trusted proxies in X-Forwarded-For.
+func clientIP(remoteAddr string, forwardedFor []string, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if !trustedProxy(host, trustedProxies) {
+		return host
+	}
+	hops := []string{}
+	for _, header := range forwardedFor {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !trustedProxy(hops[i], trustedProxies) {
+			if _, err := netip.ParseAddr(hops[i]); err != nil {
+				// Garbage in the header; the last hop we trust is the best we know.
+				return host
+			}
+			return hops[i]
+		}
+		host = hops[i]
+	}
+	return host
+}
+
+func trustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// commonLogLine formats the entry in Common Log Format:
+// `host ident authuser [date] "request line" status bytes`.
+func commonLogLine(entry AccessLogEntry, requestURI string, proto string) string {
+	user := "-"
+	if entry.Subject != "" {
+		user = strings.ReplaceAll(entry.Subject, " ", "_")
+	}
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.Itoa(entry.Bytes)
+	}
+	requestLine := strconv.Quote(fmt.Sprintf("%s %s %s", entry.Method, requestURI, proto))
+	return fmt.Sprintf("%s - %s [%s] %s %d %s",
+		entry.ClientIP, user, entry.Time.Format("02/Jan/2006:15:04:05 -0700"), requestLine, entry.Status, bytes)
+}
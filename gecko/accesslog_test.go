@@ -0,0 +1,101 @@
+package gecko
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// newAccessLoggedRouter returns a router that trusts proxies in 10.0.0.0/8,
+// leaves /health out of its access log, and the buffer the log goes to.
+func newAccessLoggedRouter(t *testing.T, format string, jwks *fixtures.JWKS) (*iris.Application, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	accessLog, err := NewAccessLog(out, format)
+	assert.NoError(t, err)
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithAnonymousReads(true).
+		WithStore(NewMemoryStore()).
+		WithAccessLog(accessLog.WithTrustedProxies(proxies).WithSkippedPaths("/health"))
+	return server.MakeRouter(), out
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	router, out := newAccessLoggedRouter(t, AccessLogFormatJSON, fixtures.NewJWKS(t))
+	serve := func(path string, remoteAddr string, forwardedFor string) AccessLogEntry {
+		out.Reset()
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		req.Header.Set(RequestIDHeader, "req-1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		entry := AccessLogEntry{}
+		if out.Len() > 0 {
+			assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+		}
+		return entry
+	}
+
+	entry := serve("/config/missing", "10.1.2.3:5000", "198.51.100.4, 203.0.113.9, 10.0.0.7")
+	assert.Equal(t, "GET", entry.Method)
+	assert.Equal(t, "/config/missing", entry.Path)
+	assert.Equal(t, "/config/{configId}", entry.Route)
+	assert.Equal(t, http.StatusNotFound, entry.Status)
+	assert.Positive(t, entry.Bytes)
+	assert.GreaterOrEqual(t, entry.LatencyMS, 0.0)
+	assert.WithinDuration(t, time.Now(), entry.Time, time.Minute)
+	assert.Equal(t, "203.0.113.9", entry.ClientIP)
+	assert.Equal(t, "req-1", entry.RequestID)
+
+	// X-Forwarded-For is only believed when a trusted proxy sends it.
+	assert.Equal(t, "198.51.100.4", serve("/config/missing", "198.51.100.4:5000", "203.0.113.9").ClientIP)
+	assert.Equal(t, "192.0.2.1", serve("/config/missing", "192.0.2.1:5000", "not-an-ip").ClientIP)
+	assert.Equal(t, "10.0.0.8", serve("/config/missing", "10.1.2.3:5000", "10.0.0.8").ClientIP)
+
+	assert.Equal(t, AccessLogEntry{}, serve("/health", "198.51.100.4:5000", ""))
+	assert.Equal(t, "unmatched", serve("/nowhere", "198.51.100.4:5000", "").Route)
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	router, out := newAccessLoggedRouter(t, AccessLogFormatCommon, jwks)
+	req := httptest.NewRequest("PUT", "/config/logged?strict=true", strings.NewReader(fixtures.TestConfig))
+	req.RemoteAddr = "198.51.100.4:5000"
+	req.Header.Set("Authorization", "Bearer "+jwks.Token(t, "alice", time.Now().Add(time.Hour)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	line := strings.TrimSpace(out.String())
+	assert.Regexp(t, `^198\.51\.100\.4 - 42 \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "PUT /config/logged\?strict=true HTTP/1\.1" 200 \d+$`, line)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8,192.0.2.1, ::1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1/32", "::1/128"}, []string{
+		proxies[0].String(), proxies[1].String(), proxies[2].String(),
+	})
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	proxies, err = ParseTrustedProxies("")
+	assert.NoError(t, err)
+	assert.Empty(t, proxies)
+}
@@ -0,0 +1,372 @@
+package gecko
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// The changes recorded as audit events.
+const (
+	AuditActionPut      = "put"
+	AuditActionPatch    = "patch"
+	AuditActionRollback = "rollback"
+	AuditActionDelete   = "delete"
+	AuditActionRestore  = "restore"
+	AuditActionPurge    = "purge"
+)
+
+// trashPurgeActor is the actor of the purges done by the trash retention.
+const trashPurgeActor = "gecko"
+
+// AuditEvent records one change to a config: who made it, from where, and
+// what changed. BeforeHash and AfterHash are the content hashes of the live
+// config before and after the change, empty where there was none, and Diff is
+// the JSON Patch (RFC 6902) from one to the other. Events are never changed
+// once recorded.
+type AuditEvent struct {
+	ID         int64           `db:"id" json:"id"`
+	Time       time.Time       `db:"created_at" json:"time"`
+	Action     string          `db:"action" json:"action"`
+	ConfigID   string          `db:"config_id" json:"configId"`
+	Actor      string          `db:"actor" json:"actor"`
+	SourceIP   string          `db:"source_ip" json:"sourceIp"`
+	RequestID  string          `db:"request_id" json:"requestId"`
+	BeforeHash string          `db:"before_hash" json:"beforeHash"`
+	AfterHash  string          `db:"after_hash" json:"afterHash"`
+	Diff       json.RawMessage `db:"diff" json:"diff"`
+}
+
+// auditEventColumns are the columns of `audit_events` that make up an
+// AuditEvent.
+const auditEventColumns = "id, created_at, action, config_id, actor, source_ip, request_id, before_hash, after_hash, diff"
+
+// AuditQuery selects audit events in the order they were recorded. After is
+// the ID of the last event on the previous page; the other fields, when set,
+// filter the events.
+type AuditQuery struct {
+	After    int64
+	ConfigID string
+	Actor    string
+	Since    time.Time
+	Limit    int
+}
+
+// matches reports whether event passes the filters of the query.
+func (query AuditQuery) matches(event AuditEvent) bool {
+	return event.ID > query.After &&
+		(query.ConfigID == "" || event.ConfigID == query.ConfigID) &&
+		(query.Actor == "" || event.Actor == query.Actor) &&
+		!event.Time.Before(query.Since)
+}
+
+// auditActor is who makes the changes in a request, and from where.
+type auditActor struct {
+	name     string
+	sourceIP string
+}
+
+type auditActorKey struct{}
+
+func withAuditActor(ctx context.Context, actor auditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActorFrom returns the actor auditMiddleware put in ctx, if any.
+func auditActorFrom(ctx context.Context) auditActor {
+	actor, _ := ctx.Value(auditActorKey{}).(auditActor)
+	return actor
+}
+
+// auditMiddleware puts the caller and the address the request came from in
+// the request context, where the stores find them to record audit events. It
+// must run after authMiddleware.
+func (server *Server) auditMiddleware(ctx iris.Context) {
+	request := ctx.Request()
+	actor := auditActor{
+		name:     tokenInfoFrom(ctx).actor(),
+		sourceIP: clientIP(request.RemoteAddr, request.Header.Values("X-Forwarded-For"), server.trustedProxies),
+	}
+	ctx.ResetRequest(request.WithContext(withAuditActor(request.Context(), actor)))
+	ctx.Next()
+}
+
+// newAuditEvent describes a change to the config name from before to after,
+// the canonical content of the live config before and after the change; nil
+// means there was none. The actor and request ID come from ctx.
+func newAuditEvent(ctx context.Context, action string, name string, before []byte, after []byte) (AuditEvent, error) {
+	actor := auditActorFrom(ctx)
+	event := AuditEvent{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		ConfigID:  name,
+		Actor:     actor.name,
+		SourceIP:  actor.sourceIP,
+		RequestID: RequestIDFrom(ctx),
+	}
+	docs := []any{}
+	for _, content := range [][]byte{before, after} {
+		if content == nil {
+			content = []byte("[]")
+		}
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return AuditEvent{}, err
+		}
+		docs = append(docs, doc)
+	}
+	if before != nil {
+		event.BeforeHash = contentHash(before)
+	}
+	if after != nil {
+		event.AfterHash = contentHash(after)
+	}
+	patch, err := diffJSON("", docs[0], docs[1])
+	if err != nil {
+		return AuditEvent{}, err
+	}
+	if patch == nil {
+		patch = []patchOperation{}
+	}
+	event.Diff, err = json.Marshal(patch)
+	if err != nil {
+		return AuditEvent{}, err
+	}
+	return event, nil
+}
+
+// handleAuditGET lists audit events, oldest first, a page at a time. It takes
+// the filters `configId`, `actor` and `since` (RFC 3339). Events about
+// configs the caller may not audit are left out of the page.
+func (server *Server) handleAuditGET(ctx iris.Context) {
+	if tokenInfoFrom(ctx) == nil {
+		server.unauthorized(ctx, "missing bearer token in Authorization header")
+		return
+	}
+	limit := ctx.URLParamIntDefault("limit", defaultListLimit)
+	if limit < 1 || limit > maxListLimit {
+		msg := fmt.Sprintf("limit must be between 1 and %d", maxListLimit)
+		errResponse := newErrorResponse(msg, 400, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	query := AuditQuery{
+		ConfigID: ctx.URLParam("configId"),
+		Actor:    ctx.URLParam("actor"),
+		// fetch one extra event to find out whether there is another page
+		Limit: limit + 1,
+	}
+	if cursor := ctx.URLParam("cursor"); cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err == nil {
+			query.After, err = strconv.ParseInt(key, 10, 64)
+		}
+		if err != nil {
+			errResponse := newErrorResponse("invalid cursor", 400, &err)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+	}
+	if since := ctx.URLParam("since"); since != "" {
+		var err error
+		query.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			msg := fmt.Sprintf("since must be an RFC 3339 time: %s", err.Error())
+			errResponse := newErrorResponse(msg, 400, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+	}
+	authorize, err := server.configAuthorizer(ctx, ActionAudit)
+	if err != nil {
+		msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	// Events of configs the caller may not audit are left out, so keep
+	// fetching until the page is full or there is nothing left.
+	page := []AuditEvent{}
+	more := false
+	for !more {
+		events, err := server.store.AuditEvents(ctx.Request().Context(), query)
+		if err != nil {
+			msg := fmt.Sprintf("audit query failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, 500, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		for _, event := range events {
+			authorized, err := authorize(event.ConfigID)
+			if err != nil {
+				msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+				errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+				errResponse.log.write(server.requestLogger(ctx))
+				_ = errResponse.write(ctx)
+				return
+			}
+			if !authorized {
+				continue
+			}
+			if len(page) == limit {
+				more = true
+				break
+			}
+			page = append(page, event)
+		}
+		if len(events) < query.Limit {
+			break
+		}
+		query.After = events[len(events)-1].ID
+	}
+	nextCursor := ""
+	if more {
+		nextCursor = encodeCursor(strconv.FormatInt(page[limit-1].ID, 10))
+	}
+	response := map[string]any{"events": page, "nextCursor": nextCursor}
+	_ = jsonResponseFrom(response, http.StatusOK).write(ctx)
+}
+
+// AuditSink receives copies of audit events in the order they were recorded.
+type AuditSink interface {
+	// LastID is the ID of the last event the sink received, or 0.
+	LastID() int64
+	Write(event AuditEvent) error
+}
+
+// AuditFileSink appends audit events to a file as JSON lines. It picks up
+// after the last event already in the file, so that events are exported once
+// across restarts.
+type AuditFileSink struct {
+	mu     sync.Mutex
+	file   *os.File
+	lastID int64
+}
+
+func NewAuditFileSink(path string) (*AuditFileSink, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	sink := &AuditFileSink{file: file}
+	err = sink.resume()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not read audit file %s: %w", path, err)
+	}
+	return sink, nil
+}
+
+// resume finds the ID of the last event in the file. A line cut short, by a
+// crash in the middle of a write, is skipped, and ended so the next event
+// starts on a line of its own.
+func (sink *AuditFileSink) resume() error {
+	reader := bufio.NewReader(sink.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		event := struct {
+			ID int64 `json:"id"`
+		}{}
+		if json.Unmarshal(line, &event) == nil {
+			sink.lastID = event.ID
+		}
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				_, err = sink.file.Write([]byte("\n"))
+				return err
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (sink *AuditFileSink) LastID() int64 {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.lastID
+}
+
+func (sink *AuditFileSink) Write(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	_, err = sink.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	sink.lastID = event.ID
+	return nil
+}
+
+func (sink *AuditFileSink) Close() error {
+	return sink.file.Close()
+}
+
+// auditGapTimeout is how long ExportAuditEvents waits for a missing event ID
+// to show up before it takes the ID for a rolled-back transaction's.
+const auditGapTimeout = time.Minute
+
+// ExportAuditEvents writes the audit events recorded since the last one sink
+// received to it. IDs are handed out when an event is inserted, but the
+// transactions inserting them can commit out of order, so an event can show
+// up after one with a higher ID. The export therefore stops at the first gap
+// in the IDs, and only moves past it once the event after the gap is older
+// than auditGapTimeout. The last ID the sink received thus stays a
+// watermark: no event below it is still to come.
+func (server *Server) ExportAuditEvents(ctx context.Context, sink AuditSink) error {
+	for {
+		events, err := server.store.AuditEvents(ctx, AuditQuery{After: sink.LastID(), Limit: maxListLimit})
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.ID != sink.LastID()+1 && time.Since(event.Time) < auditGapTimeout {
+				return nil
+			}
+			err = sink.Write(event)
+			if err != nil {
+				return err
+			}
+		}
+		if len(events) < maxListLimit {
+			return nil
+		}
+	}
+}
+
+// RunAuditExporter calls ExportAuditEvents every interval until ctx is done.
+func (server *Server) RunAuditExporter(ctx context.Context, sink AuditSink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := server.ExportAuditEvents(ctx, sink); err != nil {
+			server.logger.withContext(ctx).with("error", err).Error("exporting audit events failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
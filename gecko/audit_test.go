@@ -0,0 +1,281 @@
+package gecko
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+type auditPage struct {
+	Events     []AuditEvent `json:"events"`
+	NextCursor string       `json:"nextCursor"`
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	store := NewMemoryStore()
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithTrustedProxies(proxies).
+		WithStore(store)
+	router := server.MakeRouter()
+
+	req := httptest.NewRequest("PUT", "/config/audited", strings.NewReader(fixtures.TestConfig))
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Header.Set("Authorization", "Bearer "+jwks.Token(t, "alice", time.Now().Add(time.Hour)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	events, err := store.AuditEvents(context.Background(), AuditQuery{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditActionPut, events[0].Action)
+		assert.Equal(t, "audited", events[0].ConfigID)
+		assert.Equal(t, "alice", events[0].Actor)
+		assert.Equal(t, "203.0.113.9", events[0].SourceIP)
+		assert.Equal(t, "req-1", events[0].RequestID)
+		assert.Equal(t, strings.Trim(rec.Header().Get("ETag"), `"`), events[0].AfterHash)
+	}
+}
+
+func TestAuditGET(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	// The stand-in only lets the caller audit ohsu-test.
+	arboristServer := newArboristStandIn(t, "/programs/ohsu/projects/test/configs/ohsu-test", ActionAudit)
+	store := NewMemoryStore()
+	for _, actor := range []string{"alice", "bob", "alice"} {
+		ctx := withAuditActor(context.Background(), auditActor{name: actor})
+		for _, name := range []string{"ohsu-test", "ohsu-other"} {
+			_, err := store.Put(ctx, name, testConfig(t), actor, Precondition{})
+			assert.NoError(t, err)
+		}
+	}
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(NewArboristAuthorizer(arboristServer.URL)).
+		WithAnonymousReads(true).
+		WithStore(store)
+	router := server.MakeRouter()
+
+	token := jwks.Token(t, "auditor", time.Now().Add(time.Hour))
+	get := func(query string, authorized bool) (int, auditPage) {
+		req := httptest.NewRequest("GET", "/audit?"+query, nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		page := auditPage{}
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		}
+		return rec.Code, page
+	}
+
+	code, _ := get("", false)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, page := get("", true)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, page.Events, 3)
+	for _, event := range page.Events {
+		assert.Equal(t, "ohsu-test", event.ConfigID)
+	}
+
+	code, page = get("configId=ohsu-test&actor=alice&limit=1", true)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, page.Events, 1)
+	assert.NotEmpty(t, page.NextCursor)
+	first := page.Events[0]
+	code, page = get("configId=ohsu-test&actor=alice&limit=1&cursor="+page.NextCursor, true)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, page.Events, 1) {
+		assert.Greater(t, page.Events[0].ID, first.ID)
+		assert.Equal(t, "alice", page.Events[0].Actor)
+		assert.Equal(t, first.AfterHash, page.Events[0].BeforeHash)
+	}
+	assert.Empty(t, page.NextCursor)
+
+	since := time.Now().Add(time.Hour).Format(time.RFC3339)
+	code, page = get("since="+since, true)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, page.Events)
+
+	code, _ = get("since=yesterday", true)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("cursor=!", true)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("limit=0", true)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAuditFileSink(t *testing.T) {
+	store := NewMemoryStore()
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithStore(store)
+	ctx := withAuditActor(context.Background(), auditActor{name: "alice"})
+	put := func(name string) {
+		_, err := store.Put(ctx, name, testConfig(t), "alice", Precondition{})
+		assert.NoError(t, err)
+	}
+	lines := func(path string) []AuditEvent {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		events := []AuditEvent{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			event := AuditEvent{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &event))
+			events = append(events, event)
+		}
+		return events
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	put("first")
+	put("second")
+	sink, err := NewAuditFileSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.NoError(t, sink.Close())
+	events := lines(path)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "first", events[0].ConfigID)
+	assert.Equal(t, "alice", events[1].Actor)
+
+	// A new sink on the same file picks up where the last one stopped, even
+	// after a write was cut short.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"id":`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	put("third")
+	sink, err = NewAuditFileSink(path)
+	assert.NoError(t, err)
+	assert.Equal(t, events[1].ID, sink.LastID())
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.NoError(t, sink.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	last := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, last, 4)
+	assert.Contains(t, last[3], `"configId":"third"`)
+}
+
+// gappedAuditStore serves a fixed list of audit events, standing in for a
+// database where transactions commit out of ID order.
+type gappedAuditStore struct {
+	*MemoryStore
+	events []AuditEvent
+}
+
+func (store *gappedAuditStore) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	for _, event := range store.events {
+		if query.matches(event) && len(events) < query.Limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+type auditSliceSink struct {
+	events []AuditEvent
+}
+
+func (sink *auditSliceSink) LastID() int64 {
+	if len(sink.events) == 0 {
+		return 0
+	}
+	return sink.events[len(sink.events)-1].ID
+}
+
+func (sink *auditSliceSink) Write(event AuditEvent) error {
+	sink.events = append(sink.events, event)
+	return nil
+}
+
+func TestExportAuditEventsWaitsForGaps(t *testing.T) {
+	now := time.Now()
+	store := &gappedAuditStore{MemoryStore: NewMemoryStore()}
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithStore(store)
+	sink := &auditSliceSink{}
+	ids := func() []int64 {
+		ids := []int64{}
+		for _, event := range sink.events {
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+	ctx := context.Background()
+
+	// Event 3 is still being committed when 4 is visible.
+	store.events = []AuditEvent{{ID: 1, Time: now}, {ID: 2, Time: now}, {ID: 4, Time: now}}
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.Equal(t, []int64{1, 2}, ids())
+
+	store.events = []AuditEvent{{ID: 1, Time: now}, {ID: 2, Time: now}, {ID: 3, Time: now}, {ID: 4, Time: now}}
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids())
+
+	// Event 5 was rolled back, so the gap never fills and is passed once
+	// event 6 is old enough.
+	store.events = append(store.events, AuditEvent{ID: 6, Time: now})
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids())
+	store.events[4].Time = now.Add(-2 * auditGapTimeout)
+	assert.NoError(t, server.ExportAuditEvents(ctx, sink))
+	assert.Equal(t, []int64{1, 2, 3, 4, 6}, ids())
+}
+
+// failingAuditStore fails every audit query.
+type failingAuditStore struct {
+	*MemoryStore
+}
+
+func (failingAuditStore) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestRunAuditExporterLogsErrors(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(out, LogFormatJSON, slog.LevelInfo)
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(logger).
+		WithStore(failingAuditStore{NewMemoryStore()})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server.RunAuditExporter(ctx, &auditSliceSink{}, time.Hour)
+
+	records := logRecords(t, out)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "exporting audit events failed", records[0]["msg"])
+		assert.Equal(t, "database unavailable", records[0]["error"])
+	}
+}
@@ -0,0 +1,221 @@
+package gecko
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+const (
+	ActionRead   string = "read"
+	ActionUpdate string = "update"
+	ActionDelete string = "delete"
+	// ActionPurge is needed on top of ActionDelete to delete a config for
+	// good instead of moving it to the trash.
+	ActionPurge string = "purge"
+	// ActionAudit lets a caller read the audit events of a config.
+	ActionAudit string = "audit"
+)
+
+// AuthzService is the service name gecko checks actions under.
+const AuthzService string = "gecko"
+
+// Authorizer decides whether the bearer of a token may perform an action on a
+// resource path.
+type Authorizer interface {
+	Authorize(token string, resource string, action string) (bool, error)
+}
+
+// BatchAuthorizer is an Authorizer that can also look up everything the bearer
+// of a token may do in one request, so that listings do not have to ask about
+// every config on their own.
+type BatchAuthorizer interface {
+	Authorizer
+	Permissions(token string) (Permissions, error)
+}
+
+// Permissions maps resource paths to the actions allowed on them, as
+// Arborist's `/auth/mapping` returns them. An action allowed on a resource is
+// allowed on every resource below it too.
+type Permissions arborist.AuthMapping
+
+// Allow reports whether action is allowed on resource under AuthzService.
+func (permissions Permissions) Allow(resource string, action string) bool {
+	for path, actions := range permissions {
+		if resource != path && !strings.HasPrefix(resource, strings.TrimSuffix(path, "/")+"/") {
+			continue
+		}
+		for _, allowed := range actions {
+			if (allowed.Service == AuthzService || allowed.Service == "*") &&
+				(allowed.Method == action || allowed.Method == "*") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowAuthenticated lets every caller with a valid token do anything, for
+// deployments without Arborist.
+type AllowAuthenticated struct{}
+
+func (AllowAuthenticated) Authorize(token string, resource string, action string) (bool, error) {
+	return true, nil
+}
+
+// ArboristAuthorizer checks actions against an Arborist-compatible
+// `/auth/request` endpoint, and looks up permissions at `/auth/mapping`.
+type ArboristAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+func NewArboristAuthorizer(arboristURL string) *ArboristAuthorizer {
+	return &ArboristAuthorizer{
+		url:    strings.TrimSuffix(arboristURL, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (authz *ArboristAuthorizer) Authorize(token string, resource string, action string) (bool, error) {
+	authRequest := arborist.AuthRequestJSON{
+		User: arborist.AuthRequestJSON_User{Token: token},
+		Requests: []arborist.AuthRequestJSON_Request{{
+			Resource: resource,
+			Action:   arborist.Action{Service: AuthzService, Method: action},
+		}},
+	}
+	body, err := json.Marshal(authRequest)
+	if err != nil {
+		return false, err
+	}
+	resp, err := authz.client.Post(authz.url+"/auth/request", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("arborist request failed: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("arborist returned unexpected status %d", resp.StatusCode)
+	}
+	authResponse := arborist.AuthResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&authResponse)
+	if err != nil {
+		return false, fmt.Errorf("could not parse arborist response: %s", err.Error())
+	}
+	return authResponse.Auth, nil
+}
+
+// Permissions fetches the auth mapping of the bearer of token.
+func (authz *ArboristAuthorizer) Permissions(token string) (Permissions, error) {
+	req, err := http.NewRequest(http.MethodGet, authz.url+"/auth/mapping", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := authz.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("arborist request failed: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("arborist returned unexpected status %d", resp.StatusCode)
+	}
+	permissions := Permissions{}
+	err = json.NewDecoder(resp.Body).Decode(&permissions)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse arborist response: %s", err.Error())
+	}
+	return permissions, nil
+}
+
+// configResourcePath maps a configId to the resource path it is authorized
+// under. Config IDs named after a Gen3 project (`<program>-<project>`) live
+// under that project; anything else lives under `/configs`.
+func configResourcePath(configId string) string {
+	program, project, found := strings.Cut(configId, "-")
+	if !found || program == "" || project == "" {
+		return fmt.Sprintf("/configs/%s", configId)
+	}
+	return fmt.Sprintf("/programs/%s/projects/%s/configs/%s", program, project, configId)
+}
+
+// authorize reports whether the caller may perform action on configId. With
+// anonymous reads enabled every read is allowed.
+func (server *Server) authorize(ctx iris.Context, configId string, action string) (bool, error) {
+	if action == ActionRead && server.anonymousReads {
+		return true, nil
+	}
+	info := tokenInfoFrom(ctx)
+	if info == nil {
+		return false, nil
+	}
+	return server.authorizer.Authorize(info.token, configResourcePath(configId), action)
+}
+
+// configAuthorizer returns a function that reports whether the caller may
+// perform action on a config, for handlers that check many configs. A
+// BatchAuthorizer is asked once for all of them; any other Authorizer once per
+// config.
+func (server *Server) configAuthorizer(ctx iris.Context, action string) (func(configId string) (bool, error), error) {
+	if action == ActionRead && server.anonymousReads {
+		return func(string) (bool, error) { return true, nil }, nil
+	}
+	info := tokenInfoFrom(ctx)
+	if info == nil {
+		return func(string) (bool, error) { return false, nil }, nil
+	}
+	if batch, ok := server.authorizer.(BatchAuthorizer); ok {
+		permissions, err := batch.Permissions(info.token)
+		if err != nil {
+			return nil, err
+		}
+		return func(configId string) (bool, error) {
+			return permissions.Allow(configResourcePath(configId), action), nil
+		}, nil
+	}
+	decisions := map[string]bool{}
+	return func(configId string) (bool, error) {
+		authorized, checked := decisions[configId]
+		if checked {
+			return authorized, nil
+		}
+		authorized, err := server.authorizer.Authorize(info.token, configResourcePath(configId), action)
+		if err != nil {
+			return false, err
+		}
+		decisions[configId] = authorized
+		return authorized, nil
+	}, nil
+}
+
+// authzMiddleware checks that the caller may perform action on the config
+// named by the `configId` route parameter. It must run after authMiddleware.
+func (server *Server) authzMiddleware(action string) iris.Handler {
+	return func(ctx iris.Context) {
+		configId := ctx.Params().Get("configId")
+		authorized, err := server.authorize(ctx, configId, action)
+		if err != nil {
+			msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			ctx.StopExecution()
+			return
+		}
+		if !authorized {
+			msg := fmt.Sprintf("not authorized to %s %s", action, configResourcePath(configId))
+			errResponse := newErrorResponse(msg, http.StatusForbidden, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			ctx.StopExecution()
+			return
+		}
+		ctx.Next()
+	}
+}
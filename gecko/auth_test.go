@@ -0,0 +1,206 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/arborist/arborist"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// arboristStandIn counts the requests it gets.
+type arboristStandIn struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+// newArboristStandIn answers `/auth/request` with `auth: true` only for the
+// given resource and method, and `/auth/mapping` with just that permission.
+func newArboristStandIn(t *testing.T, resource string, method string) *arboristStandIn {
+	standIn := &arboristStandIn{}
+	standIn.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		standIn.requests.Add(1)
+		if r.URL.Path == "/auth/mapping" {
+			assert.NotEmpty(t, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			_ = json.NewEncoder(w).Encode(arborist.AuthMapping{
+				resource: {{Service: AuthzService, Method: method}},
+			})
+			return
+		}
+		assert.Equal(t, "/auth/request", r.URL.Path)
+		authRequest := struct {
+			User     arborist.AuthRequestJSON_User `json:"user"`
+			Requests []struct {
+				Resource string          `json:"resource"`
+				Action   arborist.Action `json:"action"`
+			} `json:"requests"`
+		}{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&authRequest))
+		assert.NotEmpty(t, authRequest.User.Token)
+		request := authRequest.Requests[0]
+		auth := request.Resource == resource &&
+			request.Action.Service == AuthzService &&
+			request.Action.Method == method
+		_ = json.NewEncoder(w).Encode(arborist.AuthResponse{Auth: auth})
+	}))
+	t.Cleanup(standIn.Close)
+	return standIn
+}
+
+func TestConfigResourcePath(t *testing.T) {
+	assert.Equal(t, "/programs/ohsu/projects/test/configs/ohsu-test", configResourcePath("ohsu-test"))
+	assert.Equal(t, "/programs/ohsu/projects/big-test/configs/ohsu-big-test", configResourcePath("ohsu-big-test"))
+	assert.Equal(t, "/configs/explorer", configResourcePath("explorer"))
+	assert.Equal(t, "/configs/-test", configResourcePath("-test"))
+}
+
+func TestAuthzMiddleware(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	arboristServer := newArboristStandIn(t, "/programs/ohsu/projects/test/configs/ohsu-test", ActionUpdate)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(NewArboristAuthorizer(arboristServer.URL))
+	router := iris.New()
+	router.Put(
+		"/config/{configId}",
+		server.authMiddleware,
+		server.authzMiddleware(ActionUpdate),
+		func(ctx iris.Context) { ctx.WriteString("ok") },
+	)
+	router.Delete(
+		"/config/{configId}",
+		server.authMiddleware,
+		server.authzMiddleware(ActionDelete),
+		func(ctx iris.Context) { ctx.WriteString("ok") },
+	)
+	assert.NoError(t, router.Build())
+
+	token := jwks.Token(t, "alice", time.Now().Add(time.Hour))
+	do := func(method string, configId string) int {
+		req := httptest.NewRequest(method, "/config/"+configId, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, do("PUT", "ohsu-test"))
+	assert.Equal(t, http.StatusForbidden, do("PUT", "ohsu-other"))
+	assert.Equal(t, http.StatusForbidden, do("DELETE", "ohsu-test"))
+}
+
+func TestHardDeleteNeedsPurge(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	// The stand-in allows delete but not purge.
+	arboristServer := newArboristStandIn(t, "/programs/ohsu/projects/test/configs/ohsu-test", ActionDelete)
+	ctx := context.Background()
+	store := NewMemoryStore()
+	_, err := store.Put(ctx, "ohsu-test", []config.ConfigItem{}, "alice", Precondition{})
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(NewArboristAuthorizer(arboristServer.URL)).
+		WithStore(store)
+	router := server.MakeRouter()
+
+	token := jwks.Token(t, "alice", time.Now().Add(time.Hour))
+	do := func(path string) int {
+		req := httptest.NewRequest("DELETE", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, do("/config/ohsu-test?hard=true"))
+	assert.Equal(t, http.StatusOK, do("/config/ohsu-test"))
+	trashed, err := store.Trash(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, trashed, 1)
+}
+
+func TestPermissionsAllow(t *testing.T) {
+	permissions := Permissions{
+		"/programs/ohsu":  {{Service: AuthzService, Method: ActionRead}},
+		"/configs/shared": {{Service: "*", Method: "*"}},
+		"/configs/other":  {{Service: "fence", Method: ActionRead}},
+	}
+	assert.True(t, permissions.Allow("/programs/ohsu/projects/test/configs/ohsu-test", ActionRead))
+	assert.False(t, permissions.Allow("/programs/ohsu/projects/test/configs/ohsu-test", ActionUpdate))
+	assert.False(t, permissions.Allow("/programs/ohsu-2/projects/test/configs/ohsu-test", ActionRead))
+	assert.True(t, permissions.Allow("/configs/shared", ActionPurge))
+	assert.False(t, permissions.Allow("/configs/other", ActionRead))
+}
+
+func TestListingsFillPages(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	// The caller may read and audit the configs of the ohsu program only.
+	arboristServer := newArboristStandIn(t, "/programs/ohsu", "*")
+	store := NewMemoryStore()
+	for _, name := range []string{"a", "b", "ohsu-c", "d", "e", "ohsu-f", "g", "ohsu-h"} {
+		_, err := store.Put(context.Background(), name, testConfig(t), "alice", Precondition{})
+		assert.NoError(t, err)
+	}
+	router := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(NewArboristAuthorizer(arboristServer.URL)).
+		WithStore(store).
+		MakeRouter()
+
+	token := jwks.Token(t, "alice", time.Now().Add(time.Hour))
+	get := func(path string, page any) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), page))
+	}
+
+	var configs struct {
+		Configs    []ConfigSummary `json:"configs"`
+		NextCursor string          `json:"nextCursor"`
+	}
+	get("/config?limit=2", &configs)
+	names := []string{}
+	for _, summary := range configs.Configs {
+		names = append(names, summary.Name)
+	}
+	assert.Equal(t, []string{"ohsu-c", "ohsu-f"}, names)
+	assert.NotEmpty(t, configs.NextCursor)
+	// one request to Arborist for the whole page
+	assert.Equal(t, int64(1), arboristServer.requests.Load())
+
+	get("/config?limit=2&cursor="+configs.NextCursor, &configs)
+	if assert.Len(t, configs.Configs, 1) {
+		assert.Equal(t, "ohsu-h", configs.Configs[0].Name)
+	}
+	assert.Empty(t, configs.NextCursor)
+
+	var events auditPage
+	get("/audit?limit=2", &events)
+	if assert.Len(t, events.Events, 2) {
+		assert.Equal(t, "ohsu-c", events.Events[0].ConfigID)
+		assert.Equal(t, "ohsu-f", events.Events[1].ConfigID)
+	}
+	assert.NotEmpty(t, events.NextCursor)
+	get("/audit?limit=2&cursor="+events.NextCursor, &events)
+	if assert.Len(t, events.Events, 1) {
+		assert.Equal(t, "ohsu-h", events.Events[0].ConfigID)
+	}
+	assert.Empty(t, events.NextCursor)
+	assert.Equal(t, int64(4), arboristServer.requests.Load())
+}
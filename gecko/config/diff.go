@@ -0,0 +1,282 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Summarize describes what changed from one config to another, one line per
+// change, for people reviewing a config before it is promoted. Tabs are
+// matched by tabTitle, filter tabs by title and buttons by title. Changes the
+// summary has no wording for are still reported, as "... changed".
+func Summarize(from []ConfigItem, to []ConfigItem) []string {
+	lines := []string{}
+	add := func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	fromTabs := map[string]ConfigItem{}
+	for _, item := range from {
+		fromTabs[item.TabTitle] = item
+	}
+	toTabs := map[string]ConfigItem{}
+	for _, item := range to {
+		toTabs[item.TabTitle] = item
+	}
+	fromOrder, toOrder := []string{}, []string{}
+	for _, item := range from {
+		if _, exists := toTabs[item.TabTitle]; !exists {
+			add("tab %q removed", item.TabTitle)
+		} else {
+			fromOrder = append(fromOrder, item.TabTitle)
+		}
+	}
+	for _, item := range to {
+		if _, exists := fromTabs[item.TabTitle]; !exists {
+			add("tab %q added", item.TabTitle)
+		} else {
+			toOrder = append(toOrder, item.TabTitle)
+		}
+	}
+	if !slices.Equal(fromOrder, toOrder) {
+		add("tabs reordered: %s", quoteAll(toOrder))
+	}
+
+	for _, title := range toOrder {
+		for _, line := range summarizeTab(fromTabs[title], toTabs[title]) {
+			add("tab %q: %s", title, line)
+		}
+	}
+	return lines
+}
+
+func summarizeTab(from ConfigItem, to ConfigItem) []string {
+	lines := []string{}
+	add := func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	if from.GuppyConfig.DataType != to.GuppyConfig.DataType {
+		add("dataType changed from %q to %q", from.GuppyConfig.DataType, to.GuppyConfig.DataType)
+	}
+	fromGuppy, toGuppy := from.GuppyConfig, to.GuppyConfig
+	fromGuppy.DataType, toGuppy.DataType = "", ""
+	if !sameJSON(fromGuppy, toGuppy) {
+		add("guppyConfig changed")
+	}
+
+	for _, key := range sortedKeys(mergeKeys(from.Charts, to.Charts)) {
+		fromChart, inFrom := from.Charts[key]
+		toChart, inTo := to.Charts[key]
+		switch {
+		case !inTo:
+			add("chart %q removed", key)
+		case !inFrom:
+			add("chart %q added", key)
+		case !sameJSON(fromChart, toChart):
+			add("chart %q changed", key)
+		}
+	}
+
+	lines = append(lines, summarizeFilters(from.Filters, to.Filters)...)
+	lines = append(lines, summarizeTable(from.Table, to.Table)...)
+	lines = append(lines, summarizeButtons(from.Buttons, to.Buttons)...)
+
+	if !sameJSON(from.Dropdowns, to.Dropdowns) {
+		add("dropdowns changed")
+	}
+	if from.LoginForDownload != to.LoginForDownload {
+		add("loginForDownload changed to %t", to.LoginForDownload)
+	}
+	if !sameJSON(from.Extras, to.Extras) {
+		add("unmodelled properties changed")
+	}
+	return lines
+}
+
+func summarizeFilters(from FiltersConfig, to FiltersConfig) []string {
+	lines := []string{}
+	add := func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+	fromTabs := map[string]FilterTab{}
+	for _, tab := range from.Tabs {
+		fromTabs[tab.Title] = tab
+	}
+	toTabs := map[string]FilterTab{}
+	for _, tab := range to.Tabs {
+		toTabs[tab.Title] = tab
+	}
+	for _, tab := range from.Tabs {
+		if _, exists := toTabs[tab.Title]; !exists {
+			add("filter tab %q removed", tab.Title)
+		}
+	}
+	for _, toTab := range to.Tabs {
+		fromTab, exists := fromTabs[toTab.Title]
+		if !exists {
+			add("filter tab %q added", toTab.Title)
+			continue
+		}
+		added, removed := compareLists(fromTab.Fields, toTab.Fields)
+		for _, field := range added {
+			add("filter field %q added to filter tab %q", field, toTab.Title)
+		}
+		for _, field := range removed {
+			add("filter field %q removed from filter tab %q", field, toTab.Title)
+		}
+		if reordered(fromTab.Fields, toTab.Fields) {
+			add("filter fields of filter tab %q reordered", toTab.Title)
+		}
+		fromTab.Fields, toTab.Fields = nil, nil
+		if !sameJSON(fromTab, toTab) {
+			add("filter tab %q changed", toTab.Title)
+		}
+	}
+	if !sameJSON(from.Extras, to.Extras) {
+		add("filters changed")
+	}
+	return lines
+}
+
+func summarizeTable(from TableConfig, to TableConfig) []string {
+	lines := []string{}
+	add := func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+	if from.Enabled != to.Enabled {
+		add("table enabled changed to %t", to.Enabled)
+	}
+	added, removed := compareLists(from.Fields, to.Fields)
+	for _, field := range added {
+		add("table field %q added", field)
+	}
+	for _, field := range removed {
+		add("table field %q removed", field)
+	}
+	if reordered(from.Fields, to.Fields) {
+		add("table fields reordered")
+	}
+	for _, field := range sortedKeys(mergeKeys(from.Columns, to.Columns)) {
+		fromColumn, inFrom := from.Columns[field]
+		toColumn, inTo := to.Columns[field]
+		switch {
+		case !inTo:
+			add("column %q removed", field)
+		case !inFrom:
+			add("column %q added", field)
+		case fromColumn.Title != toColumn.Title:
+			add("column %q retitled from %q to %q", field, fromColumn.Title, toColumn.Title)
+			fromColumn.Title = toColumn.Title
+			fallthrough
+		default:
+			if !sameJSON(fromColumn, toColumn) {
+				add("column %q changed", field)
+			}
+		}
+	}
+	from.Enabled, from.Fields, from.Columns = false, nil, nil
+	to.Enabled, to.Fields, to.Columns = false, nil, nil
+	if !sameJSON(from, to) {
+		add("table settings changed")
+	}
+	return lines
+}
+
+func summarizeButtons(from []ButtonConfig, to []ButtonConfig) []string {
+	lines := []string{}
+	add := func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+	fromButtons := map[string]ButtonConfig{}
+	for i, button := range from {
+		fromButtons[buttonKey(i, button)] = button
+	}
+	toButtons := map[string]ButtonConfig{}
+	for i, button := range to {
+		toButtons[buttonKey(i, button)] = button
+	}
+	for i, button := range from {
+		if _, exists := toButtons[buttonKey(i, button)]; !exists {
+			add("button %s removed", buttonKey(i, button))
+		}
+	}
+	for i, button := range to {
+		key := buttonKey(i, button)
+		fromButton, exists := fromButtons[key]
+		if !exists {
+			add("button %s added", key)
+		} else if !sameJSON(fromButton, button) {
+			add("button %s changed", key)
+		}
+	}
+	return lines
+}
+
+// buttonKey names a button by its title, or by its position if it has none.
+func buttonKey(i int, button ButtonConfig) string {
+	if button.Title != "" {
+		return fmt.Sprintf("%q", button.Title)
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// compareLists returns the values only in to and the values only in from,
+// each in the order of its list.
+func compareLists(from []string, to []string) (added []string, removed []string) {
+	for _, value := range to {
+		if !slices.Contains(from, value) {
+			added = append(added, value)
+		}
+	}
+	for _, value := range from {
+		if !slices.Contains(to, value) {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+// reordered reports whether the values in both lists are in a different
+// order in to than in from.
+func reordered(from []string, to []string) bool {
+	common := func(values []string, other []string) []string {
+		kept := []string{}
+		for _, value := range values {
+			if slices.Contains(other, value) {
+				kept = append(kept, value)
+			}
+		}
+		return kept
+	}
+	return !slices.Equal(common(from, to), common(to, from))
+}
+
+func mergeKeys[V any](a map[string]V, b map[string]V) map[string]bool {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+// sameJSON compares values by their JSON encoding, so that, e.g., a nil and
+// an empty map under omitempty are the same.
+func sameJSON(a any, b any) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aJSON) == string(bJSON)
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	var from, to []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &from))
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &to))
+	assert.Empty(t, Summarize(from, to))
+
+	var added []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &added))
+	added[0].TabTitle = "Patient"
+	to = append(added, to...)
+	to[1].Filters.Tabs[0].Fields = append(to[1].Filters.Tabs[0].Fields, "c")
+	to[1].Table.Fields = []string{"a", "project_id"}
+	to[1].Table.Columns["a"] = TableColumnsConfig{Field: "a", Title: "A"}
+	to[1].Table.DetailsConfig.Mode = "click"
+	delete(to[1].Charts, "b")
+	to[1].Buttons = []ButtonConfig{{Title: "Download", Type: "manifest"}}
+	to[1].Extras = Extras{"futureFlag": json.RawMessage("true")}
+
+	assert.Equal(t, []string{
+		`tab "Patient" added`,
+		`tab "test": chart "b" removed`,
+		`tab "test": filter field "c" added to filter tab "Filters"`,
+		`tab "test": table field "b" removed`,
+		`tab "test": table fields reordered`,
+		`tab "test": column "a" retitled from "a" to "A"`,
+		`tab "test": table settings changed`,
+		`tab "test": button "Download" added`,
+		`tab "test": unmodelled properties changed`,
+	}, Summarize(from, to))
+
+	assert.Equal(t, []string{`tab "Patient" removed`}, Summarize(to[:2], to[1:2]))
+	assert.Equal(t, []string{`tabs reordered: "test", "Patient"`}, Summarize(to[:2], []ConfigItem{to[1], to[0]}))
+}
@@ -1,97 +1,110 @@
 package config
 
 type FieldConfig struct {
-	Field     string `json:"field,omitempty"`
-	DataField string `json:"dataField,omitempty"`
-	Index     string `json:"index,omitempty"`
-	Label     string `json:"label"`
-	Type      string `json:"type,omitempty"`
+	Field     string `json:"field,omitempty" description:"Guppy field the filter applies to."`
+	DataField string `json:"dataField,omitempty" description:"Field in the data index, when it differs from field."`
+	Index     string `json:"index,omitempty" description:"Guppy index the field belongs to."`
+	Label     string `json:"label" description:"Label shown for the filter."`
+	Type      string `json:"type,omitempty" description:"How the filter is rendered."`
+	Extras    Extras `json:"-"`
 }
 
 type FilterTab struct {
-	Title        string                 `json:"title,omitempty"`
-	Fields       []string               `json:"fields"`
-	FieldsConfig map[string]FieldConfig `json:"fieldsConfig,omitempty"`
+	Title        string                 `json:"title,omitempty" description:"Title of the filter tab."`
+	Fields       []string               `json:"fields" description:"Fields shown as filters, in order."`
+	FieldsConfig map[string]FieldConfig `json:"fieldsConfig,omitempty" description:"Filter settings, keyed by field. When given, every field needs an entry."`
+	Extras       Extras                 `json:"-"`
 }
 
 type FiltersConfig struct {
-	Tabs []FilterTab `json:"tabs"`
+	Tabs   []FilterTab `json:"tabs" description:"Tabs of the filter panel."`
+	Extras Extras      `json:"-"`
 }
 
 type TableConfig struct {
-	Enabled       bool                          `json:"enabled"`
-	Fields        []string                      `json:"fields"`
-	Columns       map[string]TableColumnsConfig `json:"columns,omitempty"`
-	DetailsConfig TableDetailsConfig            `json:"detailsConfig,omitempty"`
+	Enabled       bool                          `json:"enabled" description:"Whether the table is shown."`
+	Fields        []string                      `json:"fields" description:"Fields shown as columns, in order."`
+	Columns       map[string]TableColumnsConfig `json:"columns,omitempty" description:"Column settings, keyed by field. When given, every field needs an entry."`
+	DetailsConfig TableDetailsConfig            `json:"detailsConfig,omitempty" description:"Panel with the details of a row."`
+	Extras        Extras                        `json:"-"`
 }
 
 type TableColumnsConfig struct {
-	Field string `json:"field"`
-	Title string `json:"title"`
+	Field  string `json:"field" description:"Field shown in the column."`
+	Title  string `json:"title" description:"Header of the column."`
+	Extras Extras `json:"-"`
 }
 
 type TableDetailsConfig struct {
-	Panel       string            `json:"panel,omitempty"`
-	Mode        string            `json:"mode,omitempty"`
-	IDField     string            `json:"idField,omitempty"`
-	FilterField string            `json:"filterField,omitempty"`
-	Title       string            `json:"title,omitempty"`
-	NodeType    string            `json:"nodeType,omitempty"`
-	NodeFields  map[string]string `json:"nodeFields,omitempty"`
+	Panel       string            `json:"panel,omitempty" description:"Name of the panel component."`
+	Mode        string            `json:"mode,omitempty" description:"How the panel is opened from a row."`
+	IDField     string            `json:"idField,omitempty" description:"Field that identifies a row."`
+	FilterField string            `json:"filterField,omitempty" description:"Field the panel filters its query on."`
+	Title       string            `json:"title,omitempty" description:"Title of the panel."`
+	NodeType    string            `json:"nodeType,omitempty" description:"Type of the node shown in the panel."`
+	NodeFields  map[string]string `json:"nodeFields,omitempty" description:"Labels of the node fields shown in the panel, keyed by field."`
+	Extras      Extras            `json:"-"`
 }
 
 type GuppyConfig struct {
-	DataType                  string              `json:"dataType"`
-	NodeCountTitle            string              `json:"nodeCountTitle"`
-	FieldMapping              []GuppyFieldMapping `json:"fieldMapping,omitempty"`
-	AccessibleFieldCheckList  []string            `json:"accessibleFieldCheckList,omitempty"`
-	AccessibleValidationField string              `json:"accessibleValidationField,omitempty"`
-	ManifestMapping           ManifestMapping     `json:"manifestMapping,omitempty"`
+	DataType                  string              `json:"dataType" description:"Guppy index type the tab explores."`
+	NodeCountTitle            string              `json:"nodeCountTitle" description:"Title of the count of matching records."`
+	FieldMapping              []GuppyFieldMapping `json:"fieldMapping,omitempty" description:"Display names of fields."`
+	AccessibleFieldCheckList  []string            `json:"accessibleFieldCheckList,omitempty" description:"Fields checked to decide whether the user can access a record."`
+	AccessibleValidationField string              `json:"accessibleValidationField,omitempty" description:"Field used to validate access to a record."`
+	ManifestMapping           ManifestMapping     `json:"manifestMapping,omitempty" description:"How records map to the files in a manifest."`
+	Extras                    Extras              `json:"-"`
 }
 
 type GuppyFieldMapping struct {
-	Field string `json:"field,omitempty"`
-	Name  string `json:"name,omitempty"`
+	Field  string `json:"field,omitempty" description:"Guppy field."`
+	Name   string `json:"name,omitempty" description:"Display name of the field."`
+	Extras Extras `json:"-"`
 }
 
 type ManifestMapping struct {
-	ResourceIndexType               string `json:"resourceIndexType,omitempty"`
-	ResourceIdField                 string `json:"resourceIdField,omitempty"`
-	ReferenceIdFieldInResourceIndex string `json:"referenceIdFieldInResourceIndex,omitempty"`
-	ReferenceIdFieldInDataIndex     string `json:"referenceIdFieldInDataIndex,omitempty"`
+	ResourceIndexType               string `json:"resourceIndexType,omitempty" description:"Guppy index type of the files."`
+	ResourceIdField                 string `json:"resourceIdField,omitempty" description:"Field that identifies a file."`
+	ReferenceIdFieldInResourceIndex string `json:"referenceIdFieldInResourceIndex,omitempty" description:"Field of the file index that refers to a record."`
+	ReferenceIdFieldInDataIndex     string `json:"referenceIdFieldInDataIndex,omitempty" description:"Field of the data index the file index refers to."`
+	Extras                          Extras `json:"-"`
 }
 
 type Chart struct {
-	ChartType string `json:"chartType"`
-	Title     string `json:"title"`
+	ChartType string `json:"chartType" description:"How the chart is drawn."`
+	Title     string `json:"title" description:"Title of the chart."`
+	Extras    Extras `json:"-"`
 }
 
 type ButtonConfig struct {
-	Enabled    bool             `json:"enabled,omitempty"`
-	Type       string           `json:"type,omitempty"`
-	Action     string           `json:"action,omitempty"`
-	Title      string           `json:"title,omitempty"`
-	LeftIcon   string           `json:"leftIcon,omitempty"`
-	RightIcon  string           `json:"rightIcon,omitempty"`
-	FileName   string           `json:"fileName,omitempty"`
-	ActionArgs ButtonActionArgs `json:"actionArgs,omitempty"`
+	Enabled    bool             `json:"enabled,omitempty" description:"Whether the button is shown."`
+	Type       string           `json:"type,omitempty" description:"What the button downloads or exports."`
+	Action     string           `json:"action,omitempty" description:"Action run when the button is clicked."`
+	Title      string           `json:"title,omitempty" description:"Label of the button."`
+	LeftIcon   string           `json:"leftIcon,omitempty" description:"Icon shown left of the title."`
+	RightIcon  string           `json:"rightIcon,omitempty" description:"Icon shown right of the title."`
+	FileName   string           `json:"fileName,omitempty" description:"Name of the downloaded file."`
+	ActionArgs ButtonActionArgs `json:"actionArgs,omitempty" description:"Arguments passed to the action."`
+	Extras     Extras           `json:"-"`
 }
 
 type ButtonActionArgs struct {
-	ResourceIndexType               string   `json:"resourceIndexType,omitempty"`
-	ResourceIdField                 string   `json:"resourceIdField,omitempty"`
-	ReferenceIdFieldInDataIndex     string   `json:"referenceIdFieldInDataIndex,omitempty"`
-	ReferenceIdFieldInResourceIndex string   `json:"referenceIdFieldInResourceIndex,omitempty"`
-	FileFields                      []string `json:"fileFields,omitempty"`
+	ResourceIndexType               string   `json:"resourceIndexType,omitempty" description:"Guppy index type of the files."`
+	ResourceIdField                 string   `json:"resourceIdField,omitempty" description:"Field that identifies a file."`
+	ReferenceIdFieldInDataIndex     string   `json:"referenceIdFieldInDataIndex,omitempty" description:"Field of the data index the file index refers to."`
+	ReferenceIdFieldInResourceIndex string   `json:"referenceIdFieldInResourceIndex,omitempty" description:"Field of the file index that refers to a record."`
+	FileFields                      []string `json:"fileFields,omitempty" description:"Fields included in the downloaded file."`
+	Extras                          Extras   `json:"-"`
 }
 
 type ConfigItem struct {
-	TabTitle         string           `json:"tabTitle"`
-	GuppyConfig      GuppyConfig      `json:"guppyConfig"`
-	Charts           map[string]Chart `json:"charts,omitempty"`
-	Filters          FiltersConfig    `json:"filters"`
-	Table            TableConfig      `json:"table"`
-	Dropdowns        map[string]any   `json:"dropdowns,omitempty"`
-	Buttons          []ButtonConfig   `json:"buttons,omitempty"`
-	LoginForDownload bool             `json:"loginForDownload,omitempty"`
+	TabTitle         string           `json:"tabTitle" description:"Title of the explorer tab. Unique within a config."`
+	GuppyConfig      GuppyConfig      `json:"guppyConfig" description:"Guppy index the tab explores."`
+	Charts           map[string]Chart `json:"charts,omitempty" description:"Summary charts, keyed by field."`
+	Filters          FiltersConfig    `json:"filters" description:"Filter panel of the tab."`
+	Table            TableConfig      `json:"table" description:"Table of matching records."`
+	Dropdowns        map[string]any   `json:"dropdowns,omitempty" description:"Dropdown menus that group buttons, keyed by name."`
+	Buttons          []ButtonConfig   `json:"buttons,omitempty" description:"Download and export buttons."`
+	LoginForDownload bool             `json:"loginForDownload,omitempty" description:"Whether downloads require the user to log in."`
+	Extras           Extras           `json:"-"`
 }
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extras holds the properties of a JSON object that its config type does not
+// model, such as ones added by a newer frontend, so that they survive a round
+// trip through gecko. Every config type has an Extras field.
+type Extras map[string]json.RawMessage
+
+// UnknownFields returns the path of every property in items that was kept in
+// an Extras map, e.g. `[0].filter` for a misspelled `filters`.
+//
+// Strict decoding is built on this rather than on DisallowUnknownFields: the
+// decoder does not pass that setting on to UnmarshalJSON methods, and it would
+// stop at the first unknown key instead of reporting all of them.
+func UnknownFields(items []ConfigItem) []string {
+	paths := []string{}
+	collectUnknownFields(reflect.ValueOf(items), "", &paths)
+	return paths
+}
+
+var extrasType = reflect.TypeOf(Extras{})
+
+func collectUnknownFields(value reflect.Value, path string, paths *[]string) {
+	switch value.Kind() {
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			collectUnknownFields(value.Index(i), fmt.Sprintf("%s[%d]", path, i), paths)
+		}
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return
+		}
+		keys := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			collectUnknownFields(value.MapIndex(reflect.ValueOf(key)), path+"."+key, paths)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.Type == extrasType {
+				for _, key := range sortedKeys(value.Field(i).Interface().(Extras)) {
+					*paths = append(*paths, path+"."+key)
+				}
+				continue
+			}
+			if name := jsonName(field); name != "" {
+				collectUnknownFields(value.Field(i), path+"."+name, paths)
+			}
+		}
+	}
+}
+
+// jsonName returns the property name of a struct field, or "" if the field is
+// not marshalled.
+func jsonName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+var knownFieldsCache sync.Map // reflect.Type -> []string
+
+// knownFields returns the property names the struct type t unmarshals.
+func knownFields(t reflect.Type) []string {
+	if names, ok := knownFieldsCache.Load(t); ok {
+		return names.([]string)
+	}
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	knownFieldsCache.Store(t, names)
+	return names
+}
+
+// unmarshalWithExtras decodes data into v, a pointer to a struct type without
+// an UnmarshalJSON method, and keeps the properties v has no field for in
+// extras. Like encoding/json, it matches property names case-insensitively.
+func unmarshalWithExtras(data []byte, v any, extras *Extras) error {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return err
+	}
+	properties := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &properties)
+	if err != nil {
+		return err
+	}
+	*extras = nil
+	known := knownFields(reflect.TypeOf(v).Elem())
+	for key, value := range properties {
+		isKnown := false
+		for _, name := range known {
+			if strings.EqualFold(key, name) {
+				isKnown = true
+				break
+			}
+		}
+		if isKnown {
+			continue
+		}
+		value, err = canonicalJSON(value)
+		if err != nil {
+			return err
+		}
+		if *extras == nil {
+			*extras = Extras{}
+		}
+		(*extras)[key] = value
+	}
+	return nil
+}
+
+// canonicalJSON re-encodes data with the keys of its objects sorted and
+// without whitespace. Extras are kept in this form so that a config hashes the
+// same before and after Postgres, which reorders the keys of JSONB objects,
+// has stored it. Numbers are copied as they are.
+func canonicalJSON(data json.RawMessage) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// marshalWithExtras encodes v, a struct without a MarshalJSON method, with the
+// properties in extras added. Modelled properties win over extras of the same
+// name.
+func marshalWithExtras(v any, extras Extras) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extras) == 0 {
+		return data, err
+	}
+	properties := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &properties)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range extras {
+		if _, exists := properties[key]; !exists {
+			properties[key] = value
+		}
+	}
+	return json.Marshal(properties)
+}
+
+func (c *FieldConfig) UnmarshalJSON(data []byte) error {
+	type fieldConfig FieldConfig
+	return unmarshalWithExtras(data, (*fieldConfig)(c), &c.Extras)
+}
+
+func (c FieldConfig) MarshalJSON() ([]byte, error) {
+	type fieldConfig FieldConfig
+	return marshalWithExtras(fieldConfig(c), c.Extras)
+}
+
+func (t *FilterTab) UnmarshalJSON(data []byte) error {
+	type filterTab FilterTab
+	return unmarshalWithExtras(data, (*filterTab)(t), &t.Extras)
+}
+
+func (t FilterTab) MarshalJSON() ([]byte, error) {
+	type filterTab FilterTab
+	return marshalWithExtras(filterTab(t), t.Extras)
+}
+
+func (c *FiltersConfig) UnmarshalJSON(data []byte) error {
+	type filtersConfig FiltersConfig
+	return unmarshalWithExtras(data, (*filtersConfig)(c), &c.Extras)
+}
+
+func (c FiltersConfig) MarshalJSON() ([]byte, error) {
+	type filtersConfig FiltersConfig
+	return marshalWithExtras(filtersConfig(c), c.Extras)
+}
+
+func (c *TableConfig) UnmarshalJSON(data []byte) error {
+	type tableConfig TableConfig
+	return unmarshalWithExtras(data, (*tableConfig)(c), &c.Extras)
+}
+
+func (c TableConfig) MarshalJSON() ([]byte, error) {
+	type tableConfig TableConfig
+	return marshalWithExtras(tableConfig(c), c.Extras)
+}
+
+func (c *TableColumnsConfig) UnmarshalJSON(data []byte) error {
+	type tableColumnsConfig TableColumnsConfig
+	return unmarshalWithExtras(data, (*tableColumnsConfig)(c), &c.Extras)
+}
+
+func (c TableColumnsConfig) MarshalJSON() ([]byte, error) {
+	type tableColumnsConfig TableColumnsConfig
+	return marshalWithExtras(tableColumnsConfig(c), c.Extras)
+}
+
+func (c *TableDetailsConfig) UnmarshalJSON(data []byte) error {
+	type tableDetailsConfig TableDetailsConfig
+	return unmarshalWithExtras(data, (*tableDetailsConfig)(c), &c.Extras)
+}
+
+func (c TableDetailsConfig) MarshalJSON() ([]byte, error) {
+	type tableDetailsConfig TableDetailsConfig
+	return marshalWithExtras(tableDetailsConfig(c), c.Extras)
+}
+
+func (c *GuppyConfig) UnmarshalJSON(data []byte) error {
+	type guppyConfig GuppyConfig
+	return unmarshalWithExtras(data, (*guppyConfig)(c), &c.Extras)
+}
+
+func (c GuppyConfig) MarshalJSON() ([]byte, error) {
+	type guppyConfig GuppyConfig
+	return marshalWithExtras(guppyConfig(c), c.Extras)
+}
+
+func (m *GuppyFieldMapping) UnmarshalJSON(data []byte) error {
+	type guppyFieldMapping GuppyFieldMapping
+	return unmarshalWithExtras(data, (*guppyFieldMapping)(m), &m.Extras)
+}
+
+func (m GuppyFieldMapping) MarshalJSON() ([]byte, error) {
+	type guppyFieldMapping GuppyFieldMapping
+	return marshalWithExtras(guppyFieldMapping(m), m.Extras)
+}
+
+func (m *ManifestMapping) UnmarshalJSON(data []byte) error {
+	type manifestMapping ManifestMapping
+	return unmarshalWithExtras(data, (*manifestMapping)(m), &m.Extras)
+}
+
+func (m ManifestMapping) MarshalJSON() ([]byte, error) {
+	type manifestMapping ManifestMapping
+	return marshalWithExtras(manifestMapping(m), m.Extras)
+}
+
+func (c *Chart) UnmarshalJSON(data []byte) error {
+	type chart Chart
+	return unmarshalWithExtras(data, (*chart)(c), &c.Extras)
+}
+
+func (c Chart) MarshalJSON() ([]byte, error) {
+	type chart Chart
+	return marshalWithExtras(chart(c), c.Extras)
+}
+
+func (c *ButtonConfig) UnmarshalJSON(data []byte) error {
+	type buttonConfig ButtonConfig
+	return unmarshalWithExtras(data, (*buttonConfig)(c), &c.Extras)
+}
+
+func (c ButtonConfig) MarshalJSON() ([]byte, error) {
+	type buttonConfig ButtonConfig
+	return marshalWithExtras(buttonConfig(c), c.Extras)
+}
+
+func (a *ButtonActionArgs) UnmarshalJSON(data []byte) error {
+	type buttonActionArgs ButtonActionArgs
+	return unmarshalWithExtras(data, (*buttonActionArgs)(a), &a.Extras)
+}
+
+func (a ButtonActionArgs) MarshalJSON() ([]byte, error) {
+	type buttonActionArgs ButtonActionArgs
+	return marshalWithExtras(buttonActionArgs(a), a.Extras)
+}
+
+func (item *ConfigItem) UnmarshalJSON(data []byte) error {
+	type configItem ConfigItem
+	return unmarshalWithExtras(data, (*configItem)(item), &item.Extras)
+}
+
+func (item ConfigItem) MarshalJSON() ([]byte, error) {
+	type configItem ConfigItem
+	return marshalWithExtras(configItem(item), item.Extras)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtrasRoundTrip(t *testing.T) {
+	input := `[{
+		"tabTitle": "test",
+		"newTabProperty": {"nested": [1, 2]},
+		"guppyConfig": {"dataType": "file", "nodeCountTitle": "Files", "manifestMapping": {}, "futureFlag": true},
+		"charts": {"a": {"chartType": "bar", "title": "a", "color": "red"}},
+		"filters": {"tabs": [{"fields": ["x"], "collapsed": false}]},
+		"table": {"enabled": true, "fields": [], "detailsConfig": {}}
+	}]`
+	var items []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(input), &items))
+	assert.Equal(t, "test", items[0].TabTitle)
+	assert.Equal(t, Extras{"newTabProperty": json.RawMessage(`{"nested":[1,2]}`)}, items[0].Extras)
+	assert.Equal(t, Extras{"futureFlag": json.RawMessage(`true`)}, items[0].GuppyConfig.Extras)
+
+	output, err := json.Marshal(items)
+	assert.NoError(t, err)
+	assert.JSONEq(t, input, string(output))
+
+	assert.Equal(t, []string{
+		"[0].guppyConfig.futureFlag",
+		"[0].charts.a.color",
+		"[0].filters.tabs[0].collapsed",
+		"[0].newTabProperty",
+	}, UnknownFields(items))
+}
+
+func TestExtrasReset(t *testing.T) {
+	var chart Chart
+	assert.NoError(t, json.Unmarshal([]byte(`{"chartType": "bar", "color": "red"}`), &chart))
+	assert.Len(t, chart.Extras, 1)
+	assert.NoError(t, json.Unmarshal([]byte(`{"chartType": "pie"}`), &chart))
+	assert.Nil(t, chart.Extras)
+	assert.Empty(t, UnknownFields([]ConfigItem{{Charts: map[string]Chart{"a": chart}}}))
+}
+
+func TestExtrasCanonical(t *testing.T) {
+	// Postgres returns JSONB objects with their keys reordered.
+	var sent, stored ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(`{"tabTitle": "a", "layout": {"zeta": 1.50, "alpha": {"y": [2, {"b": 1, "a": 0}], "x": null}}}`), &sent))
+	assert.NoError(t, json.Unmarshal([]byte(`{"layout": {"alpha": {"x": null, "y": [2, {"a": 0, "b": 1}]}, "zeta": 1.50}, "tabTitle": "a"}`), &stored))
+	sentJSON, err := json.Marshal(sent)
+	assert.NoError(t, err)
+	storedJSON, err := json.Marshal(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, string(sentJSON), string(storedJSON))
+	assert.Contains(t, string(sentJSON), `"layout":{"alpha":{"x":null,"y":[2,{"a":0,"b":1}]},"zeta":1.50}`)
+}
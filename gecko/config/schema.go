@@ -0,0 +1,204 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SchemaDialect is the JSON Schema draft ExplorerConfigSchema follows.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaEnums restricts string properties, keyed by `<Type>.<property>`, and
+// schemaRequired lists the required ones. Both only hold what Validate already
+// enforced before the schema existed, so that no config that used to be
+// accepted is rejected now. The field and button types and the details mode
+// are left open: the frontend adds new ones.
+var schemaEnums = map[string][]string{
+	"Chart.chartType": ChartTypes,
+}
+
+var schemaRequired = map[string]bool{
+	"ConfigItem.tabTitle":    true,
+	"ConfigItem.guppyConfig": true,
+	"GuppyConfig.dataType":   true,
+	"Chart.chartType":        true,
+}
+
+// Schema is the subset of JSON Schema that describes the config types.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 SchemaType         `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// SchemaType is the type keyword: the names of the JSON types a value may
+// have. It is written as a single name when there is only one.
+type SchemaType []string
+
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// ExplorerConfigSchema returns the schema of a config, a list of ConfigItem.
+// It is generated from the config types: properties come from the json tags,
+// descriptions from the description tags, and required properties and enums
+// from schemaRequired and schemaEnums. Unknown properties are allowed,
+// since they are kept in Extras.
+var ExplorerConfigSchema = sync.OnceValue(func() *Schema {
+	defs := map[string]*Schema{}
+	return &Schema{
+		Schema:      SchemaDialect,
+		ID:          "explorer-config",
+		Title:       "Explorer config",
+		Description: "Tabs of the data explorer, in order.",
+		Type:        SchemaType{"array"},
+		Items:       schemaFor(reflect.TypeOf(ConfigItem{}), defs),
+		Defs:        defs,
+	}
+})
+
+// schemaFor returns the schema of t. Structs are added to defs and referred to
+// by $ref.
+func schemaFor(t reflect.Type, defs map[string]*Schema) *Schema {
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: SchemaType{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: SchemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaType{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaType{"number"}}
+	case reflect.Slice, reflect.Array:
+		// encoding/json writes nil slices and maps as null.
+		return &Schema{Type: SchemaType{"array", "null"}, Items: schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return &Schema{Type: SchemaType{"object", "null"}, AdditionalProperties: schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := &Schema{Ref: "#/$defs/" + t.Name()}
+		if _, exists := defs[t.Name()]; exists {
+			return ref
+		}
+		def := &Schema{Type: SchemaType{"object"}, Properties: map[string]*Schema{}}
+		defs[t.Name()] = def
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := jsonName(field)
+			if name == "" {
+				continue
+			}
+			// Keywords next to a $ref apply too in 2020-12, so descriptions can
+			// go on the property without touching the definition.
+			property := schemaFor(field.Type, defs)
+			property.Description = field.Tag.Get("description")
+			property.Enum = schemaEnums[t.Name()+"."+name]
+			def.Properties[name] = property
+			if schemaRequired[t.Name()+"."+name] {
+				def.Required = append(def.Required, name)
+			}
+		}
+		return ref
+	default:
+		// Anything goes, e.g. the values of map[string]any.
+		return &Schema{}
+	}
+}
+
+// Validate checks a decoded JSON value, as produced by json.Unmarshal into an
+// any, against the schema and returns every problem found, in a stable order.
+func (schema *Schema) Validate(value any) []ValidationError {
+	problems := []ValidationError{}
+	schema.validate(schema, value, "", &problems)
+	return problems
+}
+
+func (schema *Schema) validate(root *Schema, value any, path string, problems *[]ValidationError) {
+	add := func(format string, a ...any) {
+		*problems = append(*problems, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+	if schema.Ref != "" {
+		def, exists := root.Defs[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+		if !exists {
+			add("unresolvable $ref %q", schema.Ref)
+			return
+		}
+		def.validate(root, value, path, problems)
+	}
+	if len(schema.Type) > 0 {
+		actual := jsonType(value, slices.Contains(schema.Type, "integer"))
+		if !slices.Contains(schema.Type, actual) {
+			add("expected %s, got %s", strings.Join(schema.Type, " or "), actual)
+			return
+		}
+	}
+	if schema.Enum != nil {
+		if s, ok := value.(string); !ok || !slices.Contains(schema.Enum, s) {
+			add("%v is not one of %s", value, strings.Join(schema.Enum, ", "))
+		}
+	}
+	switch value := value.(type) {
+	case []any:
+		if schema.Items != nil {
+			for i, item := range value {
+				schema.Items.validate(root, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, exists := value[name]; !exists {
+				*problems = append(*problems, ValidationError{
+					Path:    path + "." + name,
+					Message: fmt.Sprintf("%s is required", name),
+				})
+			}
+		}
+		for _, key := range sortedKeys(value) {
+			if property, exists := schema.Properties[key]; exists {
+				property.validate(root, value[key], path+"."+key, problems)
+			} else if schema.AdditionalProperties != nil {
+				schema.AdditionalProperties.validate(root, value[key], path+"."+key, problems)
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of value. Numbers without a fraction are
+// called integers when integer is set.
+func jsonType(value any, integer bool) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if integer && value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
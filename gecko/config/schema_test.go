@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplorerConfigSchema(t *testing.T) {
+	schema := ExplorerConfigSchema()
+	assert.Equal(t, SchemaDialect, schema.Schema)
+	assert.Equal(t, "#/$defs/ConfigItem", schema.Items.Ref)
+
+	item := schema.Defs["ConfigItem"]
+	assert.Equal(t, []string{"tabTitle", "guppyConfig"}, item.Required)
+	assert.Equal(t, []string{"dataType"}, schema.Defs["GuppyConfig"].Required)
+	assert.Equal(t, "#/$defs/GuppyConfig", item.Properties["guppyConfig"].Ref)
+	assert.NotEmpty(t, item.Properties["tabTitle"].Description)
+	assert.NotContains(t, item.Properties, "Extras")
+	assert.Equal(t, ChartTypes, schema.Defs["Chart"].Properties["chartType"].Enum)
+	assert.Empty(t, schema.Defs["FieldConfig"].Properties["type"].Enum)
+	assert.Empty(t, schema.Defs["ButtonConfig"].Properties["type"].Enum)
+	assert.Empty(t, schema.Defs["TableDetailsConfig"].Properties["mode"].Enum)
+
+	data, err := json.Marshal(schema.Defs["Chart"])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"type":"object"`)
+}
+
+func TestSchemaValidateFixture(t *testing.T) {
+	var raw any
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &raw))
+	assert.Empty(t, ExplorerConfigSchema().Validate(raw))
+
+	// Whatever gecko writes back has to pass too, including nil slices.
+	var items []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &items))
+	items = append(items, ConfigItem{TabTitle: "empty"})
+	data, err := json.Marshal(items)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &raw))
+	assert.Empty(t, ExplorerConfigSchema().Validate(raw))
+}
+
+func TestSchemaValidateMinimalConfig(t *testing.T) {
+	// Validate has accepted this since before the schema existed: no
+	// filters, no table, no titles or labels, and types the schema does
+	// not list.
+	input := `[{
+		"tabTitle": "Files",
+		"guppyConfig": {"dataType": "file"},
+		"charts": {"a": {"chartType": "bar"}},
+		"buttons": [{"type": "zip"}]
+	}, {
+		"tabTitle": "Cases",
+		"guppyConfig": {"dataType": "case"},
+		"filters": {"tabs": [{"fields": ["x"], "fieldsConfig": {"x": {"type": "slider"}}}]},
+		"table": {"fields": ["x"], "columns": {"x": {}}, "detailsConfig": {"mode": "expand"}}
+	}]`
+	var items []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(input), &items))
+	assert.Empty(t, Validate(items))
+	var raw any
+	assert.NoError(t, json.Unmarshal([]byte(input), &raw))
+	assert.Empty(t, ExplorerConfigSchema().Validate(raw))
+}
+
+func TestSchemaValidateReportsEveryProblem(t *testing.T) {
+	var raw any
+	input := `[{
+		"guppyConfig": {"dataType": 1, "nodeCountTitle": "Files"},
+		"charts": {"a": {"chartType": "scatter", "title": "a"}},
+		"filters": {"tabs": [{"fields": ["x"], "fieldsConfig": {"x": {"label": "x", "type": "slider"}}}]},
+		"table": {"enabled": "yes", "fields": [], "detailsConfig": {"mode": "click"}},
+		"futureFlag": true
+	}]`
+	assert.NoError(t, json.Unmarshal([]byte(input), &raw))
+	assert.Equal(t, []ValidationError{
+		{Path: "[0].tabTitle", Message: "tabTitle is required"},
+		{Path: "[0].charts.a.chartType", Message: "scatter is not one of bar, donut, fullPie, horizontalStacked, pie"},
+		{Path: "[0].guppyConfig.dataType", Message: "expected string, got number"},
+		{Path: "[0].table.enabled", Message: "expected boolean, got string"},
+	}, ExplorerConfigSchema().Validate(raw))
+
+	assert.Equal(t, []ValidationError{
+		{Path: "", Message: "expected array, got object"},
+	}, ExplorerConfigSchema().Validate(map[string]any{}))
+}
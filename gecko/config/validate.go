@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ChartTypes are the values of Chart.ChartType the explorer can render.
+var ChartTypes = []string{"bar", "donut", "fullPie", "horizontalStacked", "pie"}
+
+// ValidationError is one problem found in a config. Path is the JSON path to
+// the offending value, e.g. `[0].table.columns.project_id`.
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (err ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// Validate checks a config for problems that would break the explorer and
+// returns every one it finds, in a stable order. A config that unmarshals
+// cleanly can still be invalid, e.g. a table field without a column.
+func Validate(items []ConfigItem) []ValidationError {
+	problems := []ValidationError{}
+	add := func(path string, format string, a ...any) {
+		problems = append(problems, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	tabTitles := map[string]int{}
+	for i, item := range items {
+		path := fmt.Sprintf("[%d]", i)
+
+		if item.TabTitle == "" {
+			add(path+".tabTitle", "tabTitle is required")
+		} else if first, exists := tabTitles[item.TabTitle]; exists {
+			add(path+".tabTitle", "duplicate tabTitle %q, also used by [%d]", item.TabTitle, first)
+		} else {
+			tabTitles[item.TabTitle] = i
+		}
+
+		if item.GuppyConfig.DataType == "" {
+			add(path+".guppyConfig.dataType", "dataType is required")
+		}
+
+		for _, key := range sortedKeys(item.Charts) {
+			chartType := item.Charts[key].ChartType
+			if !slices.Contains(ChartTypes, chartType) {
+				add(
+					fmt.Sprintf("%s.charts.%s.chartType", path, key),
+					"unknown chartType %q, expected one of %s",
+					chartType, strings.Join(ChartTypes, ", "),
+				)
+			}
+		}
+
+		for j, tab := range item.Filters.Tabs {
+			// fieldsConfig is optional, but once given it has to cover every
+			// field, or the explorer renders filters without a label.
+			if len(tab.FieldsConfig) == 0 {
+				continue
+			}
+			for _, field := range tab.Fields {
+				if _, exists := tab.FieldsConfig[field]; !exists {
+					add(
+						fmt.Sprintf("%s.filters.tabs[%d].fieldsConfig.%s", path, j, field),
+						"filter field %q has no fieldsConfig entry",
+						field,
+					)
+				}
+			}
+		}
+
+		// Same for table columns.
+		if len(item.Table.Columns) > 0 {
+			for _, field := range item.Table.Fields {
+				if _, exists := item.Table.Columns[field]; !exists {
+					add(
+						fmt.Sprintf("%s.table.columns.%s", path, field),
+						"table field %q has no columns entry",
+						field,
+					)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
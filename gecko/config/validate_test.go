@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFixture(t *testing.T) {
+	var items []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &items))
+	assert.Empty(t, Validate(items))
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	var items, duplicate []ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &items))
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &duplicate))
+	items = append(items, duplicate...)
+	items[0].GuppyConfig.DataType = ""
+	items[0].Charts["a"] = Chart{ChartType: "scatter", Title: "a"}
+	items[0].Filters.Tabs[0].Fields = append(items[0].Filters.Tabs[0].Fields, "missing_filter")
+	items[0].Table.Fields = append(items[0].Table.Fields, "missing_column")
+
+	paths := []string{}
+	for _, problem := range Validate(items) {
+		paths = append(paths, problem.Path)
+	}
+	assert.Equal(t, []string{
+		"[0].guppyConfig.dataType",
+		"[0].charts.a.chartType",
+		"[0].filters.tabs[0].fieldsConfig.missing_filter",
+		"[0].table.columns.missing_column",
+		"[1].tabTitle",
+	}, paths)
+}
@@ -0,0 +1,79 @@
+package gecko
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// CORS lets browser apps on other origins call gecko. With no AllowedOrigins
+// gecko sends no CORS headers, and browsers keep to the same origin.
+type CORS struct {
+	// AllowedOrigins are the origins allowed, such as
+	// `https://portal.example.org`, or `*` for any.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and the Authorization
+	// header along, from the origins listed by name; never for `*`.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight
+	// request.
+	MaxAge time.Duration
+}
+
+// corsExposedHeaders are the response headers gecko sets that browser apps
+// need to read.
+var corsExposedHeaders = []string{"ETag", RequestIDHeader}
+
+// WithCORS answers CORS preflight requests and adds CORS headers to the
+// responses for the allowed origins.
+func (server *Server) WithCORS(cors CORS) *Server {
+	server.cors = cors
+	return server
+}
+
+func (cors CORS) allowsOrigin(origin string) bool {
+	return slices.Contains(cors.AllowedOrigins, "*") || slices.Contains(cors.AllowedOrigins, origin)
+}
+
+// middleware must run before routing, since no route answers OPTIONS.
+func (cors CORS) middleware(ctx iris.Context) {
+	origin := ctx.GetHeader("Origin")
+	ctx.Header("Vary", "Origin")
+	if origin == "" || !cors.allowsOrigin(origin) {
+		ctx.Next()
+		return
+	}
+	// Credentials are only allowed for the origins listed by name: echoing
+	// any origin with credentials would let every site call gecko as the
+	// signed-in user.
+	if slices.Contains(cors.AllowedOrigins, origin) {
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		if cors.AllowCredentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+	} else {
+		ctx.Header("Access-Control-Allow-Origin", "*")
+	}
+
+	preflight := ctx.Method() == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+	if !preflight {
+		ctx.Header("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		ctx.Next()
+		return
+	}
+	ctx.Header("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+	if len(cors.AllowedHeaders) > 0 {
+		ctx.Header("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+	}
+	if cors.MaxAge > 0 {
+		ctx.Header("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+	}
+	ctx.StatusCode(http.StatusNoContent)
+	ctx.StopExecution()
+}
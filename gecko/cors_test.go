@@ -0,0 +1,82 @@
+package gecko
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+func TestCORS(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	newRouter := func(cors CORS) http.Handler {
+		return NewServer().
+			WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+			WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+			WithAuthorizer(fixtures.AllowAll{}).
+			WithCORS(cors).
+			WithStore(NewMemoryStore()).
+			MakeRouter()
+	}
+	request := func(router http.Handler, method string, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/config/cors", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	router := newRouter(CORS{
+		AllowedOrigins:   []string{"https://portal.example.org"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute,
+	})
+	rec := request(router, http.MethodOptions, "https://portal.example.org")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://portal.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, PUT", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "60", rec.Header().Get("Access-Control-Max-Age"))
+
+	rec = request(router, http.MethodGet, "https://portal.example.org")
+	assert.Equal(t, "https://portal.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "ETag")
+
+	rec = request(router, http.MethodOptions, "https://evil.example.org")
+	assert.NotEqual(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	router = newRouter(CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}})
+	rec = request(router, http.MethodGet, "https://anywhere.example.org")
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// Credentials are never allowed for an origin only matched by `*`.
+	router = newRouter(CORS{
+		AllowedOrigins:   []string{"https://portal.example.org", "*"},
+		AllowedMethods:   []string{http.MethodGet},
+		AllowCredentials: true,
+	})
+	rec = request(router, http.MethodOptions, "https://evil.example.org")
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+	rec = request(router, http.MethodGet, "https://portal.example.org")
+	assert.Equal(t, "https://portal.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Without allowed origins, no CORS headers are sent.
+	router = newRouter(CORS{})
+	rec = request(router, http.MethodGet, "https://portal.example.org")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,142 @@
+package gecko
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/kataras/iris/v12"
+)
+
+// ConfigDiff describes the changes from one config, or config version, to
+// another: Patch is a JSON Patch (RFC 6902) that turns From into To, and
+// Summary lists the changes for people.
+type ConfigDiff struct {
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Patch   []patchOperation `json:"patch"`
+	Summary []string         `json:"summary"`
+}
+
+// diffConfigs compares two configs given as JSON.
+func diffConfigs(from string, fromContent []byte, to string, toContent []byte) (*ConfigDiff, error) {
+	var fromItems, toItems []config.ConfigItem
+	err := json.Unmarshal(fromContent, &fromItems)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(toContent, &toItems)
+	if err != nil {
+		return nil, err
+	}
+	fromDoc, err := decodeJSON(fromContent)
+	if err != nil {
+		return nil, err
+	}
+	toDoc, err := decodeJSON(toContent)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := diffJSON("", fromDoc, toDoc)
+	if err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		patch = []patchOperation{}
+	}
+	return &ConfigDiff{
+		From:    from,
+		To:      to,
+		Patch:   patch,
+		Summary: config.Summarize(fromItems, toItems),
+	}, nil
+}
+
+// handleConfigDiffGET compares the config in the path with another config,
+// e.g. staging with production. The caller needs read access to both.
+func (server *Server) handleConfigDiffGET(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	otherId := ctx.Params().Get("otherId")
+	authorized, err := server.authorize(ctx, otherId, ActionRead)
+	if err != nil {
+		msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if !authorized {
+		msg := fmt.Sprintf("not authorized to %s %s", ActionRead, configResourcePath(otherId))
+		errResponse := newErrorResponse(msg, http.StatusForbidden, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+
+	contents := [][]byte{}
+	for _, name := range []string{configId, otherId} {
+		doc, err := server.store.Get(ctx.Request().Context(), name)
+		if err != nil {
+			msg := fmt.Sprintf("config query failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, 500, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		if doc == nil {
+			msg := fmt.Sprintf("no configId found with configId: %s", name)
+			errResponse := newErrorResponse(msg, 404, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		content, err := canonicalContent(doc.Content)
+		if err != nil {
+			errResponse := newErrorResponse("config encoding failed", 500, &err)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		contents = append(contents, content)
+	}
+	server.writeDiff(ctx, configId, contents[0], otherId, contents[1])
+}
+
+// handleConfigVersionDiffGET compares two versions of a config.
+func (server *Server) handleConfigVersionDiffGET(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	contents := [][]byte{}
+	for _, version := range []int{ctx.Params().GetIntDefault("version", 0), ctx.Params().GetIntDefault("otherVersion", 0)} {
+		doc, err := server.store.Version(ctx.Request().Context(), configId, version)
+		if err != nil {
+			msg := fmt.Sprintf("config version query failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, 500, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		if doc == nil {
+			msg := fmt.Sprintf("no version %d found with configId: %s", version, configId)
+			errResponse := newErrorResponse(msg, 404, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		contents = append(contents, doc.Content)
+	}
+	from := fmt.Sprintf("%s@%d", configId, ctx.Params().GetIntDefault("version", 0))
+	to := fmt.Sprintf("%s@%d", configId, ctx.Params().GetIntDefault("otherVersion", 0))
+	server.writeDiff(ctx, from, contents[0], to, contents[1])
+}
+
+func (server *Server) writeDiff(ctx iris.Context, from string, fromContent []byte, to string, toContent []byte) {
+	diff, err := diffConfigs(from, fromContent, to, toContent)
+	if err != nil {
+		errResponse := newErrorResponse("config diff failed", 500, &err)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	_ = jsonResponseFrom(diff, http.StatusOK).write(ctx)
+}
@@ -0,0 +1,89 @@
+package gecko
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/kataras/iris/v12"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Precondition holds the conditional headers of a request. An empty field
+// means the header was not sent.
+type Precondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+func preconditionFrom(ctx iris.Context) Precondition {
+	return Precondition{
+		IfMatch:     ctx.GetHeader("If-Match"),
+		IfNoneMatch: ctx.GetHeader("If-None-Match"),
+	}
+}
+
+// createOnly is true for `If-None-Match: *`, i.e. the write must not replace
+// an existing document.
+func (precondition Precondition) createOnly() bool {
+	return strings.TrimSpace(precondition.IfNoneMatch) == "*"
+}
+
+// allows evaluates the preconditions against the current state of a document,
+// following RFC 9110 section 13.2.2: If-Match uses strong comparison and
+// If-None-Match weak comparison. etag is ignored when the document does not
+// exist.
+func (precondition Precondition) allows(etag string, exists bool) bool {
+	if precondition.IfMatch != "" {
+		if !exists || !etagMatches(precondition.IfMatch, etag, false) {
+			return false
+		}
+	}
+	if precondition.IfNoneMatch != "" {
+		if exists && etagMatches(precondition.IfNoneMatch, etag, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// etagMatches reports whether etag is in the comma separated list from an
+// If-Match or If-None-Match header. `*` matches anything.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalContent marshals the config the same way regardless of how it was
+// stored, so that its hash can serve as a strong ETag.
+func canonicalContent(content []config.ConfigItem) ([]byte, error) {
+	return json.Marshal(content)
+}
+
+func configETag(content []config.ConfigItem) (string, error) {
+	canonical, err := canonicalContent(content)
+	if err != nil {
+		return "", err
+	}
+	return quoteETag(contentHash(canonical)), nil
+}
+
+func quoteETag(hash string) string {
+	return `"` + hash + `"`
+}
@@ -0,0 +1,35 @@
+package gecko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreconditionAllows(t *testing.T) {
+	etag := `"abc"`
+	cases := []struct {
+		name         string
+		precondition Precondition
+		exists       bool
+		allowed      bool
+	}{
+		{"no headers", Precondition{}, true, true},
+		{"if-match same", Precondition{IfMatch: `"abc"`}, true, true},
+		{"if-match list", Precondition{IfMatch: `"xyz", "abc"`}, true, true},
+		{"if-match other", Precondition{IfMatch: `"xyz"`}, true, false},
+		{"if-match weak", Precondition{IfMatch: `W/"abc"`}, true, false},
+		{"if-match star", Precondition{IfMatch: "*"}, true, true},
+		{"if-match star missing", Precondition{IfMatch: "*"}, false, false},
+		{"if-match missing", Precondition{IfMatch: `"abc"`}, false, false},
+		{"if-none-match star", Precondition{IfNoneMatch: "*"}, true, false},
+		{"if-none-match star missing", Precondition{IfNoneMatch: "*"}, false, true},
+		{"if-none-match weak", Precondition{IfNoneMatch: `W/"abc"`}, true, false},
+		{"if-none-match other", Precondition{IfNoneMatch: `"xyz"`}, true, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.allowed, c.precondition.allows(etag, c.exists))
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package gecko
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"runtime"
 	"strings"
 
+	"github.com/kataras/iris/v12"
 	"github.com/uc-cdis/arborist/arborist"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -16,86 +23,166 @@ const (
 	LogLevelError   arborist.LogLevel = "ERROR"
 )
 
+// slogLevels maps the arborist levels gecko logs at to slog levels.
+var slogLevels = map[arborist.LogLevel]slog.Level{
+	LogLevelDebug:   slog.LevelDebug,
+	LogLevelInfo:    slog.LevelInfo,
+	LogLevelWarning: slog.LevelWarn,
+	LogLevelError:   slog.LevelError,
+}
+
+// The formats NewLogger can write.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// RequestIDHeader carries the ID of a request, from the caller or made up by
+// gecko, and is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// NewLogger returns a logger writing records at level or above to w, as JSON
+// or as key=value text.
+func NewLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLogLevel reads a level name: debug, info, warning (or warn) or error.
+func ParseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToUpper(name) {
+	case "WARN":
+		return slog.LevelWarn, nil
+	default:
+		level, exists := slogLevels[arborist.LogLevel(strings.ToUpper(name))]
+		if !exists {
+			return 0, fmt.Errorf("unknown log level %q", name)
+		}
+		return level, nil
+	}
+}
+
 type LogCache struct {
 	logs []Log
 }
 
 type Log struct {
-	lvl arborist.LogLevel
-	msg string
+	lvl    arborist.LogLevel
+	msg    string
+	source string
 }
 
-func (cache *LogCache) write(logger arborist.Logger) {
+// write logs the cached entries at their levels, so that they are filtered
+// like any other record.
+func (cache *LogCache) write(handler *LogHandler) {
 	for _, log := range cache.logs {
-		logger.Print(log.msg)
+		handler.log(log.lvl, log.source, log.msg)
 	}
 }
 
+// LogHandler implements arborist.Logger on top of slog. Records carry the
+// request ID and trace ID found in its context, if any.
+type LogHandler struct {
+	logger *slog.Logger
+	ctx    context.Context
+}
+
+func newLogHandler(logger *slog.Logger) *LogHandler {
+	return &LogHandler{logger: slog.New(contextHandler{logger.Handler()}), ctx: context.Background()}
+}
+
+// withContext returns a handler that logs with the IDs in ctx.
+func (handler *LogHandler) withContext(ctx context.Context) *LogHandler {
+	return &LogHandler{logger: handler.logger, ctx: ctx}
+}
+
+// with returns a handler that adds attrs, slog key-value pairs, to every
+// record.
+func (handler *LogHandler) with(attrs ...any) *LogHandler {
+	return &LogHandler{logger: handler.logger.With(attrs...), ctx: handler.ctx}
+}
+
+func (handler *LogHandler) log(lvl arborist.LogLevel, source string, msg string) {
+	handler.logger.LogAttrs(handler.ctx, slogLevels[lvl], msg, slog.String("source", source))
+}
+
+// enabled reports whether records at lvl are written, so that messages that
+// would be dropped are not formatted.
+func (handler *LogHandler) enabled(lvl arborist.LogLevel) bool {
+	return handler.logger.Enabled(handler.ctx, slogLevels[lvl])
+}
+
 func (handler *LogHandler) Print(format string, a ...interface{}) {
-	handler.logger.Print(sprintf(format, a...))
+	if handler.enabled(LogLevelInfo) {
+		handler.log(LogLevelInfo, caller(2), sprintf(format, a...))
+	}
 }
 
 func (handler *LogHandler) Debug(format string, a ...interface{}) {
-	handler.logger.Print(logMsg(LogLevelDebug, format, a...))
+	if handler.enabled(LogLevelDebug) {
+		handler.log(LogLevelDebug, caller(2), sprintf(format, a...))
+	}
 }
 
 func (handler *LogHandler) Info(format string, a ...interface{}) {
-	handler.logger.Print(logMsg(LogLevelInfo, format, a...))
+	if handler.enabled(LogLevelInfo) {
+		handler.log(LogLevelInfo, caller(2), sprintf(format, a...))
+	}
 }
 
 func (handler *LogHandler) Warning(format string, a ...interface{}) {
-	handler.logger.Print(logMsg(LogLevelWarning, format, a...))
+	if handler.enabled(LogLevelWarning) {
+		handler.log(LogLevelWarning, caller(2), sprintf(format, a...))
+	}
 }
 
 func (handler *LogHandler) Error(format string, a ...interface{}) {
-	handler.logger.Print(logMsg(LogLevelError, format, a...))
+	if handler.enabled(LogLevelError) {
+		handler.log(LogLevelError, caller(2), sprintf(format, a...))
+	}
 }
 
 func (cache *LogCache) Debug(format string, a ...interface{}) {
-	log := Log{
-		lvl: LogLevelDebug,
-		msg: logMsg(LogLevelDebug, format, a...),
-	}
-	cache.logs = append(cache.logs, log)
+	cache.add(LogLevelDebug, format, a...)
 }
 
 func (cache *LogCache) Info(format string, a ...interface{}) {
-	log := Log{
-		lvl: LogLevelInfo,
-		msg: logMsg(LogLevelInfo, format, a...),
-	}
-	cache.logs = append(cache.logs, log)
+	cache.add(LogLevelInfo, format, a...)
 }
 
 func (cache *LogCache) Warning(format string, a ...interface{}) {
-	log := Log{
-		lvl: LogLevelWarning,
-		msg: logMsg(LogLevelWarning, format, a...),
-	}
-	cache.logs = append(cache.logs, log)
+	cache.add(LogLevelWarning, format, a...)
 }
 
 func (cache *LogCache) Error(format string, a ...interface{}) {
+	cache.add(LogLevelError, format, a...)
+}
+
+func (cache *LogCache) add(lvl arborist.LogLevel, format string, a ...interface{}) {
 	log := Log{
-		lvl: LogLevelError,
-		msg: logMsg(LogLevelError, format, a...),
+		lvl:    lvl,
+		msg:    sprintf(format, a...),
+		source: caller(3),
 	}
 	cache.logs = append(cache.logs, log)
 }
 
-func logMsg(lvl arborist.LogLevel, format string, a ...interface{}) string {
-	msg := sprintf(format, a...)
-	msg = fmt.Sprintf("%s: %s", lvl, msg)
-	// get the call from 2 stack frames above this
-	// (one call up is the LogCache method, so go one more above that)
-	_, fn, line, ok := runtime.Caller(2)
-	if ok {
-		// shorten the filepath to only the basename
-		split := strings.Split(fn, string(os.PathSeparator))
-		fn = split[len(split)-1]
-		msg = fmt.Sprintf("%s:%d: %s", fn, line, msg)
+// caller returns the file basename and line of the function depth frames up
+// the stack: 1 is the function calling caller, 2 the one calling that, and so
+// on.
+func caller(depth int) string {
+	_, fn, line, ok := runtime.Caller(depth)
+	if !ok {
+		return ""
 	}
-	return msg
+	split := strings.Split(fn, string(os.PathSeparator))
+	return fmt.Sprintf("%s:%d", split[len(split)-1], line)
 }
 
 func sprintf(format string, a ...interface{}) string {
@@ -107,3 +194,74 @@ func sprintf(format string, a ...interface{}) string {
 	}
 	return msg
 }
+
+type requestIDKey struct{}
+
+// RequestIDFrom returns the ID of the request ctx belongs to, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware takes the request ID from the X-Request-ID header, or
+// makes one up, puts it in the request context for the logs and sends it back
+// in the response.
+func requestIDMiddleware(ctx iris.Context) {
+	id := ctx.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx.Header(RequestIDHeader, id)
+	request := ctx.Request()
+	ctx.ResetRequest(request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id)))
+	ctx.Next()
+}
+
+// validRequestID accepts IDs of up to 128 printable ASCII characters, so a
+// caller cannot inject anything odd into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// requestLogger returns the server's logger with the IDs of the request.
+func (server *Server) requestLogger(ctx iris.Context) *LogHandler {
+	return server.logger.withContext(ctx.Request().Context())
+}
+
+// contextHandler adds the request ID and trace ID in the context of a record
+// as attributes.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFrom(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,104 @@
+package gecko
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// newLoggedRouter returns a router over an empty MemoryStore and the buffer
+// its JSON log goes to.
+func newLoggedRouter(t *testing.T, level slog.Level) (*iris.Application, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(out, LogFormatJSON, level)
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(logger).
+		WithJWTApp(authutils.NewJWTApplication(fixtures.NewJWKS(t).URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithAnonymousReads(true).
+		WithStore(NewMemoryStore())
+	return server.MakeRouter(), out
+}
+
+func logRecords(t *testing.T, out *bytes.Buffer) []map[string]any {
+	records := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestIDLogging(t *testing.T) {
+	router, out := newLoggedRouter(t, slog.LevelInfo)
+	out.Reset()
+
+	req := httptest.NewRequest("GET", "/config/missing", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "abc-123", rec.Header().Get(RequestIDHeader))
+
+	records := logRecords(t, out)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "INFO", records[0]["level"])
+		assert.Equal(t, "abc-123", records[0]["request_id"])
+		assert.Equal(t, "no configId found with configId: missing", records[0]["msg"])
+		assert.Contains(t, records[0]["source"], "server.go:")
+	}
+
+	// IDs that are missing or could mangle the log are replaced.
+	for _, id := range []string{"", "has space", strings.Repeat("x", 129)} {
+		req := httptest.NewRequest("GET", "/config/missing", nil)
+		req.Header.Set(RequestIDHeader, id)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Regexp(t, "^[0-9a-f]{32}$", rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestLogLevelFiltering(t *testing.T) {
+	router, out := newLoggedRouter(t, slog.LevelWarn)
+	out.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/config/missing", nil))
+	assert.Empty(t, logRecords(t, out))
+
+	router, out = newLoggedRouter(t, slog.LevelDebug)
+	out.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	records := logRecords(t, out)
+	if assert.NotEmpty(t, records) {
+		assert.Equal(t, "DEBUG", records[0]["level"])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, expected := range map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	} {
+		level, err := ParseLogLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+	_, err := ParseLogLevel("loud")
+	assert.Error(t, err)
+}
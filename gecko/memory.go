@@ -0,0 +1,396 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+)
+
+// MemoryStore is a ConfigStore that keeps everything in process memory. It
+// is safe for concurrent use and meant for tests and throwaway instances.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	nextID   int
+	docs     map[string]*memoryDocument
+	versions map[string][]DocumentVersion
+	audit    []AuditEvent
+}
+
+type memoryDocument struct {
+	id        int
+	content   []byte
+	version   int
+	createdAt time.Time
+	updatedAt time.Time
+	updatedBy string
+	deletedAt *time.Time
+}
+
+// stored decodes the document into a StoredConfig.
+func (doc *memoryDocument) stored(name string) (*StoredConfig, error) {
+	var content []config.ConfigItem
+	err := json.Unmarshal(doc.content, &content)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredConfig{
+		ID:        doc.id,
+		Name:      name,
+		Content:   content,
+		Version:   doc.version,
+		CreatedAt: doc.createdAt,
+		UpdatedAt: doc.updatedAt,
+		UpdatedBy: doc.updatedBy,
+		ETag:      quoteETag(contentHash(doc.content)),
+	}, nil
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nextID:   1,
+		docs:     map[string]*memoryDocument{},
+		versions: map[string][]DocumentVersion{},
+	}
+}
+
+func (store *MemoryStore) Get(ctx context.Context, name string) (*StoredConfig, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	doc, exists := store.live(name)
+	if !exists {
+		return nil, nil
+	}
+	return doc.stored(name)
+}
+
+func (store *MemoryStore) Put(ctx context.Context, name string, data []config.ConfigItem, author string, precondition Precondition) (string, error) {
+	content, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !precondition.allows(store.etag(name)) {
+		return "", ErrPreconditionFailed
+	}
+	event, err := newAuditEvent(ctx, AuditActionPut, name, store.content(name), content)
+	if err != nil {
+		return "", err
+	}
+	store.put(name, content, author)
+	store.record(event)
+	return quoteETag(contentHash(content)), nil
+}
+
+func (store *MemoryStore) Patch(ctx context.Context, name string, patch func(content []byte) ([]config.ConfigItem, error), author string, precondition Precondition) (string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	doc, exists := store.live(name)
+	if !exists {
+		return "", nil
+	}
+	if !precondition.allows(store.etag(name)) {
+		return "", ErrPreconditionFailed
+	}
+	data, err := patch(doc.content)
+	if err != nil {
+		return "", err
+	}
+	content, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	event, err := newAuditEvent(ctx, AuditActionPatch, name, doc.content, content)
+	if err != nil {
+		return "", err
+	}
+	store.put(name, content, author)
+	store.record(event)
+	return quoteETag(contentHash(content)), nil
+}
+
+// live returns the document name unless it is missing or in the trash. The
+// caller must hold the lock.
+func (store *MemoryStore) live(name string) (*memoryDocument, bool) {
+	doc, exists := store.docs[name]
+	if !exists || doc.deletedAt != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// etag returns the ETag of name and whether it exists. The caller must hold
+// the lock.
+func (store *MemoryStore) etag(name string) (string, bool) {
+	doc, exists := store.live(name)
+	if !exists {
+		return "", false
+	}
+	return quoteETag(contentHash(doc.content)), true
+}
+
+// content returns the content of name, or nil if it is missing or in the
+// trash. The caller must hold the lock.
+func (store *MemoryStore) content(name string) []byte {
+	doc, exists := store.live(name)
+	if !exists {
+		return nil
+	}
+	return doc.content
+}
+
+// record appends an audit event, numbering it. The caller must hold the write
+// lock.
+func (store *MemoryStore) record(event AuditEvent) {
+	event.ID = int64(len(store.audit) + 1)
+	store.audit = append(store.audit, event)
+}
+
+// put writes the document and appends a version. The caller must hold the
+// write lock.
+func (store *MemoryStore) put(name string, content []byte, author string) DocumentVersion {
+	now := time.Now().UTC()
+	doc, exists := store.docs[name]
+	if !exists {
+		doc = &memoryDocument{id: store.nextID, createdAt: now}
+		store.docs[name] = doc
+		store.nextID++
+	}
+	history := store.versions[name]
+	version := DocumentVersion{
+		Name:        name,
+		Version:     len(history) + 1,
+		Content:     content,
+		ContentHash: contentHash(content),
+		Author:      author,
+		CreatedAt:   now,
+	}
+	store.versions[name] = append(history, version)
+	doc.content = content
+	doc.version = version.Version
+	doc.updatedAt = now
+	doc.updatedBy = author
+	doc.deletedAt = nil
+	return version
+}
+
+func (store *MemoryStore) Delete(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	doc, exists := store.live(name)
+	if !exists {
+		return nil, nil
+	}
+	stored, err := doc.stored(name)
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(stored.ETag, true) {
+		return nil, ErrPreconditionFailed
+	}
+	event, err := newAuditEvent(ctx, AuditActionDelete, name, doc.content, nil)
+	if err != nil {
+		return nil, err
+	}
+	deletedAt := time.Now().UTC()
+	doc.deletedAt = &deletedAt
+	store.record(event)
+	return stored, nil
+}
+
+func (store *MemoryStore) Trash(ctx context.Context) ([]TrashedConfig, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	trashed := []TrashedConfig{}
+	for name, doc := range store.docs {
+		if doc.deletedAt != nil {
+			trashed = append(trashed, TrashedConfig{Name: name, DeletedAt: *doc.deletedAt})
+		}
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		if !trashed[i].DeletedAt.Equal(trashed[j].DeletedAt) {
+			return trashed[i].DeletedAt.After(trashed[j].DeletedAt)
+		}
+		return trashed[i].Name < trashed[j].Name
+	})
+	return trashed, nil
+}
+
+func (store *MemoryStore) Restore(ctx context.Context, name string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	doc, exists := store.docs[name]
+	if !exists || doc.deletedAt == nil {
+		return false, nil
+	}
+	event, err := newAuditEvent(ctx, AuditActionRestore, name, nil, doc.content)
+	if err != nil {
+		return false, err
+	}
+	doc.deletedAt = nil
+	store.record(event)
+	return true, nil
+}
+
+func (store *MemoryStore) Purge(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	doc, exists := store.docs[name]
+	if !exists {
+		return nil, nil
+	}
+	stored, err := doc.stored(name)
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(stored.ETag, true) {
+		return nil, ErrPreconditionFailed
+	}
+	event, err := newAuditEvent(ctx, AuditActionPurge, name, doc.content, nil)
+	if err != nil {
+		return nil, err
+	}
+	delete(store.docs, name)
+	delete(store.versions, name)
+	store.record(event)
+	return stored, nil
+}
+
+func (store *MemoryStore) PurgeTrash(ctx context.Context, before time.Time) ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	names := []string{}
+	for name, doc := range store.docs {
+		if doc.deletedAt != nil && doc.deletedAt.Before(before) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	events := make([]AuditEvent, len(names))
+	for i, name := range names {
+		event, err := newAuditEvent(ctx, AuditActionPurge, name, store.docs[name].content, nil)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = event
+	}
+	for i, name := range names {
+		delete(store.docs, name)
+		delete(store.versions, name)
+		store.record(events[i])
+	}
+	return names, nil
+}
+
+func (store *MemoryStore) List(ctx context.Context, query ConfigListQuery) ([]ConfigSummary, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	names := make([]string, 0, len(store.docs))
+	for name, doc := range store.docs {
+		if doc.deletedAt == nil && name > query.After && strings.HasPrefix(name, query.Prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	summaries := []ConfigSummary{}
+	for _, name := range names {
+		if len(summaries) >= query.Limit {
+			break
+		}
+		doc := store.docs[name]
+		var content []config.ConfigItem
+		err := json.Unmarshal(doc.content, &content)
+		if err != nil {
+			return nil, err
+		}
+		dataTypes := stringList{}
+		seen := map[string]bool{}
+		for _, item := range content {
+			dataType := item.GuppyConfig.DataType
+			if !seen[dataType] {
+				seen[dataType] = true
+				dataTypes = append(dataTypes, dataType)
+			}
+		}
+		if query.DataType != "" && !seen[query.DataType] {
+			continue
+		}
+		sort.Strings(dataTypes)
+		updatedAt := doc.updatedAt
+		summaries = append(summaries, ConfigSummary{
+			Name:      name,
+			Size:      len(doc.content),
+			Tabs:      len(content),
+			DataTypes: dataTypes,
+			UpdatedAt: &updatedAt,
+		})
+	}
+	return summaries, nil
+}
+
+func (store *MemoryStore) Versions(ctx context.Context, name string) ([]DocumentVersion, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	history := store.versions[name]
+	versions := make([]DocumentVersion, len(history))
+	for i, version := range history {
+		version.Content = nil
+		versions[len(history)-1-i] = version
+	}
+	return versions, nil
+}
+
+func (store *MemoryStore) Version(ctx context.Context, name string, version int) (*DocumentVersion, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	history := store.versions[name]
+	if version < 1 || version > len(history) {
+		return nil, nil
+	}
+	found := history[version-1]
+	return &found, nil
+}
+
+func (store *MemoryStore) Rollback(ctx context.Context, name string, version int, author string, precondition Precondition) (*DocumentVersion, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	history := store.versions[name]
+	if version < 1 || version > len(history) {
+		return nil, nil
+	}
+	if !precondition.allows(store.etag(name)) {
+		return nil, ErrPreconditionFailed
+	}
+	event, err := newAuditEvent(ctx, AuditActionRollback, name, store.content(name), history[version-1].Content)
+	if err != nil {
+		return nil, err
+	}
+	rolledBack := store.put(name, history[version-1].Content, author)
+	store.record(event)
+	rolledBack.Content = nil
+	return &rolledBack, nil
+}
+
+func (store *MemoryStore) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	events := []AuditEvent{}
+	for _, event := range store.audit {
+		if len(events) >= query.Limit {
+			break
+		}
+		if query.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (store *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
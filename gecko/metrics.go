@@ -0,0 +1,104 @@
+package gecko
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus metrics of one server, served at `/metrics`.
+// Each server has its own registry, so several servers in one process, as in
+// the tests, do not share counts.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	putBodyBytes    prometheus.Histogram
+	panics          prometheus.Counter
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gecko_http_requests_total",
+			Help: "HTTP requests handled, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gecko_http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gecko_db_query_duration_seconds",
+			Help:    "Time taken by the database functions of the store, by function.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"function"}),
+		putBodyBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "gecko_config_put_body_bytes",
+			Help:    "Size of the bodies of config PUTs.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gecko_panics_recovered_total",
+			Help: "Panics in request handlers recovered by the recovery middleware.",
+		}),
+	}
+	metrics.registry.MustRegister(
+		metrics.requests,
+		metrics.requestDuration,
+		metrics.queryDuration,
+		metrics.putBodyBytes,
+		metrics.panics,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return metrics
+}
+
+// registerDB adds the connection pool statistics of db, labelled with its
+// dialect.
+func (metrics *Metrics) registerDB(db *sqlx.DB) {
+	err := metrics.registry.Register(collectors.NewDBStatsCollector(db.DB, dialectOf(db)))
+	if err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+}
+
+// middleware counts and times requests. Routes are labelled with the path
+// they were registered with, such as `/config/{configId}`, to keep the number
+// of series bounded.
+func (metrics *Metrics) middleware(ctx iris.Context) {
+	start := time.Now()
+	ctx.Next()
+	labels := prometheus.Labels{
+		"method": ctx.Method(),
+		"route":  routeName(ctx),
+		"status": strconv.Itoa(ctx.GetStatusCode()),
+	}
+	metrics.requests.With(labels).Inc()
+	metrics.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// timeQuery starts timing the database function with the given name; call
+// the result when it returns. A nil Metrics times nothing.
+func (metrics *Metrics) timeQuery(function string) func() {
+	if metrics == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		metrics.queryDuration.WithLabelValues(function).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (metrics *Metrics) handler() iris.Handler {
+	return iris.FromStd(promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+}
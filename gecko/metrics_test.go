@@ -0,0 +1,60 @@
+package gecko
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	server := NewServer().WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	router := iris.New()
+	router.Use(server.metrics.middleware)
+	router.Use(server.recoveryMiddleware)
+	router.Get("/config/{configId}", func(ctx iris.Context) {
+		if ctx.Params().Get("configId") == "boom" {
+			panic("boom")
+		}
+		ctx.StatusCode(http.StatusOK)
+	})
+	assert.NoError(t, router.Build())
+
+	for _, path := range []string{"/config/a", "/config/b", "/config/boom"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	requests := server.metrics.requests
+	assert.Equal(t, 2.0, testutil.ToFloat64(requests.WithLabelValues("GET", "/config/{configId}", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(requests.WithLabelValues("GET", "/config/{configId}", "500")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(server.metrics.panics))
+}
+
+func TestMetricsTimeQuery(t *testing.T) {
+	var metrics *Metrics
+	metrics.timeQuery("configGET")()
+
+	metrics = NewMetrics()
+	metrics.timeQuery("configGET")()
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.queryDuration, "gecko_db_query_duration_seconds"))
+}
+
+func TestMetricsSQLiteStore(t *testing.T) {
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+	server := NewServer().WithDB(db)
+
+	_, err = server.store.Get(context.Background(), "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(server.metrics.queryDuration, "gecko_db_query_duration_seconds"))
+}
@@ -0,0 +1,311 @@
+package gecko
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+const (
+	DialectPostgres string = "postgres"
+	DialectSQLite   string = "sqlite"
+)
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so that
+// several gecko replicas starting with -auto-migrate don't race each other.
+const migrationLockKey int64 = 0x6765636b6f // "gecko"
+
+// Migration is one versioned schema change, loaded from a pair of files named
+// `<version>_<name>.up.sql` and `<version>_<name>.down.sql`.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+// dialectOf names the SQL dialect spoken by db, which picks the set of
+// migrations that apply to it.
+func dialectOf(db *sqlx.DB) string {
+	if db.DriverName() == DialectSQLite {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		filename := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(filename, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(filename, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", filename)
+		}
+		base := strings.TrimSuffix(filename, "."+direction+".sql")
+		versionString, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>", filename)
+		}
+		version, err := strconv.Atoi(versionString)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has invalid version: %s", filename, err.Error())
+		}
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the schema version this build of gecko expects for
+// the dialect.
+func LatestSchemaVersion(dialect string) (int, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// beginMigration starts a transaction holding the migration lock, with the
+// schema version table in place.
+func beginMigration(db *sqlx.DB) (*sqlx.Tx, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	stmt := `
+                CREATE TABLE IF NOT EXISTS schema_migrations (
+                    version INTEGER PRIMARY KEY,
+                    name VARCHAR(255) NOT NULL,
+                    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+                );
+        `
+	if dialectOf(db) == DialectPostgres {
+		_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockKey)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		stmt = `
+                CREATE TABLE IF NOT EXISTS schema_migrations (
+                    version INTEGER PRIMARY KEY,
+                    name VARCHAR(255) NOT NULL,
+                    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+                );
+        `
+	}
+	// SQLite has no advisory locks, but its transactions take the database
+	// write lock when they begin (see openSQLite), which serializes migrations
+	// just the same.
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func appliedVersions(q sqlx.Queryer) (map[int]time.Time, error) {
+	rows := []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}{}
+	err := sqlx.Select(q, &rows, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// MigrateUp applies every pending migration in a single transaction and
+// returns the ones it applied.
+func MigrateUp(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := loadMigrations(dialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	tx, err := beginMigration(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, migration := range migrations {
+		if _, exists := applied[migration.Version]; exists {
+			continue
+		}
+		_, err = tx.Exec(migration.up)
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s failed: %s", migration.Version, migration.Name, err.Error())
+		}
+		stmt := tx.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)")
+		_, err = tx.Exec(stmt, migration.Version, migration.Name)
+		if err != nil {
+			return nil, err
+		}
+		done = append(done, migration)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest `steps` applied migrations and returns the
+// ones it reverted.
+func MigrateDown(db *sqlx.DB, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(dialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	tx, err := beginMigration(db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, exists := applied[migration.Version]; !exists {
+			continue
+		}
+		_, err = tx.Exec(migration.down)
+		if err != nil {
+			return nil, fmt.Errorf("reverting migration %d_%s failed: %s", migration.Version, migration.Name, err.Error())
+		}
+		_, err = tx.Exec(tx.Rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+		if err != nil {
+			return nil, err
+		}
+		done = append(done, migration)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// MigrationStatuses lists every known migration and when it was applied, if
+// it was. It only reads schema_migrations, without taking the migration lock,
+// so it neither waits for a migration in progress nor creates the table: a
+// database without it has nothing applied.
+func MigrationStatuses(db *sqlx.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(dialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	exists, err := migrationTableExists(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	if exists {
+		applied, err = appliedVersions(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+		if appliedAt, exists := applied[migration.Version]; exists {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// migrationTableExists reports whether schema_migrations has been created.
+func migrationTableExists(db *sqlx.DB) (bool, error) {
+	stmt := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if dialectOf(db) == DialectSQLite {
+		stmt = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+	var exists bool
+	err := db.Get(&exists, stmt)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// SchemaVersion returns the highest migration version applied to the
+// database, or 0 if none are.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	return SchemaVersionContext(context.Background(), db)
+}
+
+// SchemaVersionContext is SchemaVersion, giving up when ctx is done.
+func SchemaVersionContext(ctx context.Context, db *sqlx.DB) (int, error) {
+	var version int
+	err := db.GetContext(ctx, &version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
@@ -0,0 +1,57 @@
+package gecko
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{DialectPostgres, DialectSQLite} {
+		migrations, err := loadMigrations(dialect)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, migrations)
+		for i, migration := range migrations {
+			assert.Equal(t, i+1, migration.Version, "%s migration versions must be contiguous", dialect)
+			assert.NotEmpty(t, migration.up)
+			assert.NotEmpty(t, migration.down)
+		}
+		latest, err := LatestSchemaVersion(dialect)
+		assert.NoError(t, err)
+		assert.Equal(t, migrations[len(migrations)-1].Version, latest)
+	}
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	latest, err := LatestSchemaVersion(DialectSQLite)
+	assert.NoError(t, err)
+
+	// A fresh database has nothing applied, and is left as it was.
+	statuses, err := MigrationStatuses(db)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, latest)
+	for _, status := range statuses {
+		assert.Nil(t, status.AppliedAt)
+	}
+	exists, err := migrationTableExists(db)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+
+	// The status does not wait for a migration in progress.
+	tx, err := beginMigration(db)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+	statuses, err = MigrationStatuses(db)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, latest)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt)
+	}
+}
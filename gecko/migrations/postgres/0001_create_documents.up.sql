@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS documents (
+    name VARCHAR(255) PRIMARY KEY,
+    content JSONB
+);
@@ -0,0 +1 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS id SERIAL;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS document_versions (
+    name VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    content JSONB NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    author VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (name, version)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS documents_deleted_at_idx;
+ALTER TABLE documents DROP COLUMN IF EXISTS deleted_at;
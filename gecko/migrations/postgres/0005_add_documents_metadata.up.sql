@@ -0,0 +1,20 @@
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_by VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE documents AS d
+SET version = latest.version,
+    created_at = first.created_at,
+    updated_at = latest.created_at,
+    updated_by = latest.author
+FROM (
+    SELECT DISTINCT ON (name) name, version, author, created_at
+    FROM document_versions
+    ORDER BY name, version DESC
+) AS latest, (
+    SELECT name, MIN(created_at) AS created_at
+    FROM document_versions
+    GROUP BY name
+) AS first
+WHERE latest.name = d.name AND first.name = d.name;
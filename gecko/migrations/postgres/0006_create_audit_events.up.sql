@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    action VARCHAR(32) NOT NULL,
+    config_id VARCHAR(255) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    source_ip VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    before_hash VARCHAR(64) NOT NULL DEFAULT '',
+    after_hash VARCHAR(64) NOT NULL DEFAULT '',
+    diff JSONB NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS audit_events_config_id ON audit_events (config_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_actor ON audit_events (actor, id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at ON audit_events (created_at);
+
+-- Audit events are immutable.
+CREATE OR REPLACE FUNCTION audit_events_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events cannot be changed';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_events_immutable ON audit_events;
+CREATE TRIGGER audit_events_immutable
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_immutable();
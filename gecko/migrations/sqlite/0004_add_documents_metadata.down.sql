@@ -0,0 +1,4 @@
+ALTER TABLE documents DROP COLUMN updated_by;
+ALTER TABLE documents DROP COLUMN updated_at;
+ALTER TABLE documents DROP COLUMN created_at;
+ALTER TABLE documents DROP COLUMN version;
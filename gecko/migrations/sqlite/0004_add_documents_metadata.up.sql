@@ -0,0 +1,19 @@
+ALTER TABLE documents ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE documents ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE documents ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+UPDATE documents
+SET version = COALESCE((
+        SELECT MAX(v.version) FROM document_versions AS v WHERE v.name = documents.name
+    ), 0),
+    created_at = (
+        SELECT MIN(v.created_at) FROM document_versions AS v WHERE v.name = documents.name
+    ),
+    updated_at = (
+        SELECT v.created_at FROM document_versions AS v
+        WHERE v.name = documents.name ORDER BY v.version DESC LIMIT 1
+    ),
+    updated_by = COALESCE((
+        SELECT v.author FROM document_versions AS v
+        WHERE v.name = documents.name ORDER BY v.version DESC LIMIT 1
+    ), '');
@@ -0,0 +1,22 @@
+package gecko
+
+import "encoding/base64"
+
+const (
+	defaultListLimit int = 50
+	maxListLimit     int = 500
+)
+
+// encodeCursor makes an opaque page cursor from the sort key of the last item
+// on a page.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
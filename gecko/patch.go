@@ -0,0 +1,501 @@
+package gecko
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types accepted by PATCH /config/{configId}.
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// ErrPatchConflict means a patch could not be applied to the current content,
+// e.g. because it removes something that does not exist or a "test" failed.
+var ErrPatchConflict = errors.New("patch does not apply")
+
+// patchOperation is one operation of a JSON Patch (RFC 6902). Value is nil
+// when the operation has no "value" member, as opposed to a JSON null.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// decodeJSON decodes data keeping numbers as json.Number, so that patching a
+// config does not change the numbers in it.
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to target and returns the
+// result. Objects are merged recursively, a null removes a member and anything
+// else, including an array, replaces the target.
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// parseJSONPatch decodes an RFC 6902 JSON Patch and checks that every
+// operation is complete.
+func parseJSONPatch(data []byte) ([]patchOperation, error) {
+	operations := []patchOperation{}
+	err := json.Unmarshal(data, &operations)
+	if err != nil {
+		return nil, err
+	}
+	for i, operation := range operations {
+		switch operation.Op {
+		case "add", "replace", "test":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("operation %d (%s) has no value", i, operation.Op)
+			}
+		case "move", "copy":
+			if _, err := parsePointer(operation.From); err != nil {
+				return nil, fmt.Errorf("operation %d (%s): %w", i, operation.Op, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d has unknown op %q", i, operation.Op)
+		}
+		if _, err := parsePointer(operation.Path); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, operation.Op, err)
+		}
+	}
+	return operations, nil
+}
+
+// applyJSONPatch applies the operations to doc in order and returns the
+// result. doc may be modified even if an operation fails. Errors that come
+// from the content of doc wrap ErrPatchConflict.
+func applyJSONPatch(doc any, operations []patchOperation) (any, error) {
+	for i, operation := range operations {
+		var err error
+		doc, err = applyPatchOperation(doc, operation)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d (%s %s): %s", ErrPatchConflict, i, operation.Op, operation.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOperation(doc any, operation patchOperation) (any, error) {
+	path, _ := parsePointer(operation.Path)
+	switch operation.Op {
+	case "add":
+		value, err := decodeJSON(operation.Value)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		value, err := decodeJSON(operation.Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, _, err = pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "move":
+		from, _ := parsePointer(operation.From)
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		doc, value, err := pointerRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "copy":
+		from, _ := parsePointer(operation.From)
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// Copy through JSON so the two places do not share maps or slices.
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		value, err = decodeJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "test":
+		expected, err := decodeJSON(operation.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(expected, actual) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", operation.Op)
+}
+
+// jsonEqual reports whether the decoded JSON values a and b are equal in the
+// sense of RFC 6902 "test": numbers are equal when their values are, so 1
+// equals 1.0, and objects and arrays when their members are.
+func jsonEqual(a any, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, xOk := new(big.Rat).SetString(a.String())
+		y, yOk := new(big.Rat).SetString(b.String())
+		return xOk && yOk && x.Cmp(y) == 0
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, exists := b[key]
+			if !exists || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses token as an index into an array of length n. The index n
+// itself is only valid when inserting.
+func arrayIndex(token string, n int, inserting bool) (int, error) {
+	if inserting && token == "-" {
+		return n, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > n || (index == n && !inserting) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate replaces the container at the parent of path with the result
+// of update, which gets the container and the last token of path. Arrays may
+// be reallocated, so the new container is stored back into its parent.
+func pointerUpdate(doc any, path []string, update func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerUpdate(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	switch container := doc.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		index, _ := arrayIndex(path[0], len(container), false)
+		container[index] = child
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a scalar", token)
+	})
+}
+
+// pointerRemove removes the value at path and returns the new doc along with
+// the removed value.
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed any
+	doc, err := pointerUpdate(doc, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove %q from a scalar", token)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, removed, nil
+}
+
+// diffJSON returns a JSON Patch that turns from into to, both decoded JSON.
+// Objects are compared member by member. Array elements are matched with a
+// longest common subsequence, where objects with a tabTitle match by title,
+// so that inserting a tab adds it instead of rewriting every tab after it.
+func diffJSON(path string, from any, to any) ([]patchOperation, error) {
+	if reflect.DeepEqual(from, to) {
+		return nil, nil
+	}
+	operations := []patchOperation{}
+	fromObject, fromIsObject := from.(map[string]any)
+	toObject, toIsObject := to.(map[string]any)
+	fromArray, fromIsArray := from.([]any)
+	toArray, toIsArray := to.([]any)
+	switch {
+	case fromIsObject && toIsObject:
+		keys := make([]string, 0, len(fromObject)+len(toObject))
+		for key := range fromObject {
+			keys = append(keys, key)
+		}
+		for key := range toObject {
+			if _, exists := fromObject[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			memberPath := path + "/" + escapePointerToken(key)
+			fromValue, inFrom := fromObject[key]
+			toValue, inTo := toObject[key]
+			switch {
+			case !inTo:
+				operations = append(operations, patchOperation{Op: "remove", Path: memberPath})
+			case !inFrom:
+				operation, err := valueOperation("add", memberPath, toValue)
+				if err != nil {
+					return nil, err
+				}
+				operations = append(operations, operation)
+			default:
+				memberOperations, err := diffJSON(memberPath, fromValue, toValue)
+				if err != nil {
+					return nil, err
+				}
+				operations = append(operations, memberOperations...)
+			}
+		}
+	case fromIsArray && toIsArray:
+		// Walk both arrays along the matched pairs. index is the position in
+		// the array as patched so far.
+		index, i, j := 0, 0, 0
+		pairs := append(matchElements(fromArray, toArray), [2]int{len(fromArray), len(toArray)})
+		for _, pair := range pairs {
+			for ; i < pair[0]; i++ {
+				operations = append(operations, patchOperation{Op: "remove", Path: fmt.Sprintf("%s/%d", path, index)})
+			}
+			for ; j < pair[1]; j++ {
+				operation, err := valueOperation("add", fmt.Sprintf("%s/%d", path, index), toArray[j])
+				if err != nil {
+					return nil, err
+				}
+				operations = append(operations, operation)
+				index++
+			}
+			if i < len(fromArray) {
+				elementOperations, err := diffJSON(fmt.Sprintf("%s/%d", path, index), fromArray[i], toArray[j])
+				if err != nil {
+					return nil, err
+				}
+				operations = append(operations, elementOperations...)
+				i, j, index = i+1, j+1, index+1
+			}
+		}
+	default:
+		operation, err := valueOperation("replace", path, to)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+func valueOperation(op string, path string, value any) (patchOperation, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return patchOperation{}, err
+	}
+	return patchOperation{Op: op, Path: path, Value: data}, nil
+}
+
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// matchElements returns the index pairs of a longest common subsequence of
+// the two arrays, compared by elementKey.
+func matchElements(from []any, to []any) [][2]int {
+	fromKeys := make([]string, len(from))
+	for i, element := range from {
+		fromKeys[i] = elementKey(element)
+	}
+	toKeys := make([]string, len(to))
+	for j, element := range to {
+		toKeys[j] = elementKey(element)
+	}
+	// lengths[i][j] is the length of the LCS of fromKeys[i:] and toKeys[j:].
+	lengths := make([][]int, len(from)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if fromKeys[i] == toKeys[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	pairs := [][2]int{}
+	for i, j := 0, 0; i < len(from) && j < len(to); {
+		switch {
+		case fromKeys[i] == toKeys[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// elementKey identifies an array element for matchElements: a tab by its
+// title, anything else by its JSON encoding.
+func elementKey(element any) string {
+	if object, ok := element.(map[string]any); ok {
+		if title, ok := object["tabTitle"].(string); ok {
+			return "tab:" + title
+		}
+	}
+	data, _ := json.Marshal(element)
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package gecko
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A.
+	cases := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, c := range cases {
+		target, err := decodeJSON([]byte(c.target))
+		assert.NoError(t, err)
+		patch, err := decodeJSON([]byte(c.patch))
+		assert.NoError(t, err)
+		result, err := json.Marshal(mergePatch(target, patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, c.result, string(result), "%s + %s", c.target, c.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Mostly examples from RFC 6902, appendix A.
+	cases := []struct {
+		name   string
+		doc    string
+		patch  string
+		result string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"replace root", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{
+			"move member",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{
+			"test numbers by value",
+			`{"a":1,"b":[0.5,{"c":100}]}`,
+			`[{"op":"test","path":"/a","value":1.0},{"op":"test","path":"","value":{"a":1e0,"b":[5e-1,{"c":1E2}]}}]`,
+			`{"a":1,"b":[0.5,{"c":100}]}`,
+		},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"remove","path":"/~01"},{"op":"add","path":"/~1","value":null}]`, `{"/":null}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			doc, err := decodeJSON([]byte(c.doc))
+			assert.NoError(t, err)
+			operations, err := parseJSONPatch([]byte(c.patch))
+			assert.NoError(t, err)
+			doc, err = applyJSONPatch(doc, operations)
+			assert.NoError(t, err)
+			result, err := json.Marshal(doc)
+			assert.NoError(t, err)
+			assert.JSONEq(t, c.result, string(result))
+		})
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	invalid := []string{
+		`{"op":"add","path":"/a","value":1}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"move","from":"a","path":"/b"}]`,
+	}
+	for _, patch := range invalid {
+		_, err := parseJSONPatch([]byte(patch))
+		assert.Error(t, err, patch)
+	}
+
+	conflicts := []struct {
+		doc   string
+		patch string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":1.5}]`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`},
+		{`{"a":[1]}`, `[{"op":"test","path":"/a","value":[1,1]}]`},
+		{`{"a":{"b":1}}`, `[{"op":"test","path":"/a","value":{"b":1,"c":null}}]`},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{`{"a":1}`, `[{"op":"remove","path":""}]`},
+	}
+	for _, c := range conflicts {
+		doc, err := decodeJSON([]byte(c.doc))
+		assert.NoError(t, err)
+		operations, err := parseJSONPatch([]byte(c.patch))
+		assert.NoError(t, err)
+		_, err = applyJSONPatch(doc, operations)
+		assert.ErrorIs(t, err, ErrPatchConflict, c.patch)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	cases := []struct {
+		from string
+		to   string
+	}{
+		{`{"a":1,"b":[1,2,3]}`, `{"a":1,"b":[1,2,3]}`},
+		{`{"a":1,"b":{"c":"d"}}`, `{"a":2,"b":{"e":"f"},"g/~":null}`},
+		{`[1,2,3,4]`, `[0,1,3,4,5]`},
+		{`["a","b","c"]`, `["c","b","a"]`},
+		{`[{"tabTitle":"A","x":1},{"tabTitle":"B"}]`, `[{"tabTitle":"B"},{"tabTitle":"C"},{"tabTitle":"A","x":2}]`},
+		{`{"a":[1]}`, `{"a":{"0":1}}`},
+		{`[]`, `[[1],{"a":[]}]`},
+	}
+	for _, c := range cases {
+		from, err := decodeJSON([]byte(c.from))
+		assert.NoError(t, err)
+		to, err := decodeJSON([]byte(c.to))
+		assert.NoError(t, err)
+		operations, err := diffJSON("", from, to)
+		assert.NoError(t, err)
+		patched, err := applyJSONPatch(from, operations)
+		assert.NoError(t, err, c.from)
+		result, err := json.Marshal(patched)
+		assert.NoError(t, err)
+		assert.JSONEq(t, c.to, string(result), "%s -> %s", c.from, c.to)
+	}
+
+	// Tabs match by title, so inserting one is a single add.
+	from, _ := decodeJSON([]byte(`[{"tabTitle":"A","x":1},{"tabTitle":"B","x":2}]`))
+	to, _ := decodeJSON([]byte(`[{"tabTitle":"C"},{"tabTitle":"A","x":1},{"tabTitle":"B","x":3}]`))
+	operations, err := diffJSON("", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []patchOperation{
+		{Op: "add", Path: "/0", Value: json.RawMessage(`{"tabTitle":"C"}`)},
+		{Op: "replace", Path: "/2/x", Value: json.RawMessage(`3`)},
+	}, operations)
+}
@@ -13,8 +13,16 @@ type jsonResponse struct {
 	code    int
 }
 
+// HTTPError is the body of an error response. Details optionally carries
+// structured information about the error, such as a list of validation
+// problems.
+type HTTPError struct {
+	arborist.HTTPError
+	Details any `json:"details,omitempty"`
+}
+
 type ErrorResponse struct {
-	HTTPError arborist.HTTPError `json:"error"`
+	HTTPError HTTPError `json:"error"`
 	// err stores an internal representation of an error in case it needs to be
 	// tracked along with the http-ish version in `HTTPError`.
 	err error
@@ -65,22 +73,30 @@ func wantPrettyJSON(r *http.Request) bool {
 
 func newErrorResponse(message string, code int, err *error) *ErrorResponse {
 	response := &ErrorResponse{
-		HTTPError: arborist.HTTPError{
-			Message: message,
-			Code:    code,
+		HTTPError: HTTPError{
+			HTTPError: arborist.HTTPError{
+				Message: message,
+				Code:    code,
+			},
 		},
 	}
 	if err != nil {
 		response.err = *err
 	}
+	// add, rather than Error or Info, so the log points at our caller.
 	if code >= 500 {
-		response.log.Error(message)
+		response.log.add(LogLevelError, message)
 	} else {
-		response.log.Info(message)
+		response.log.add(LogLevelInfo, message)
 	}
 	return response
 }
 
+func (errorResponse *ErrorResponse) withDetails(details any) *ErrorResponse {
+	errorResponse.HTTPError.Details = details
+	return errorResponse
+}
+
 func (errorResponse *ErrorResponse) write(ctx iris.Context) error {
 	var bytes []byte
 	var err error
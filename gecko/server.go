@@ -4,36 +4,50 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/netip"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/ACED-IDP/gecko/gecko/version"
 	"github.com/jmoiron/sqlx"
 	"github.com/kataras/iris/v12"
 	"github.com/uc-cdis/arborist/arborist"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type LogHandler struct {
-	logger *log.Logger
-}
-
 type Server struct {
-	iris   *iris.Application
-	db     *sqlx.DB
-	jwtApp arborist.JWTDecoder
-	logger *LogHandler
-	stmts  *arborist.CachedStmts
+	iris           *iris.Application
+	db             *sqlx.DB
+	store          ConfigStore
+	jwtApp         arborist.JWTDecoder
+	logger         *LogHandler
+	stmts          *arborist.CachedStmts
+	authorizer     Authorizer
+	anonymousReads bool
+	strictDecoding bool
+	metrics        *Metrics
+	tracer         trace.Tracer
+	accessLog      *AccessLog
+	trustedProxies []netip.Prefix
+	cors           CORS
+	draining       atomic.Bool
+	jwksFetch      sync.Mutex
 }
 
 func NewServer() *Server {
-	return &Server{}
+	return &Server{metrics: NewMetrics(), tracer: otel.Tracer(tracerName)}
 }
 
-func (server *Server) WithLogger(logger *log.Logger) *Server {
-	server.logger = &LogHandler{logger: logger}
+func (server *Server) WithLogger(logger *slog.Logger) *Server {
+	server.logger = newLogHandler(logger)
 	return server
 }
 
@@ -42,23 +56,84 @@ func (server *Server) WithJWTApp(jwtApp arborist.JWTDecoder) *Server {
 	return server
 }
 
+func (server *Server) WithAuthorizer(authorizer Authorizer) *Server {
+	server.authorizer = authorizer
+	return server
+}
+
+// WithAnonymousReads lets GET requests on configs through without a token.
+// Writes always require one.
+func (server *Server) WithAnonymousReads(anonymousReads bool) *Server {
+	server.anonymousReads = anonymousReads
+	return server
+}
+
+// WithStrictDecoding rejects configs with properties the config types do not
+// model. Otherwise they are stored as they are, and a client can still ask for
+// strict decoding of a single PUT with `?strict=true`.
+func (server *Server) WithStrictDecoding(strictDecoding bool) *Server {
+	server.strictDecoding = strictDecoding
+	return server
+}
+
+// WithTracerProvider sends the spans of requests and database queries to
+// provider instead of the global one, which does nothing unless main installs
+// one.
+func (server *Server) WithTracerProvider(provider trace.TracerProvider) *Server {
+	server.tracer = provider.Tracer(tracerName)
+	return server
+}
+
+// WithAccessLog logs every request to accessLog.
+func (server *Server) WithAccessLog(accessLog *AccessLog) *Server {
+	server.accessLog = accessLog
+	return server
+}
+
+// WithTrustedProxies makes the audit events record the client address from
+// X-Forwarded-For when a request comes through one of the given proxies; see
+// AccessLog.WithTrustedProxies.
+func (server *Server) WithTrustedProxies(proxies []netip.Prefix) *Server {
+	server.trustedProxies = proxies
+	return server
+}
+
+// WithDB backs the server with the store for the database's dialect, either
+// Postgres or SQLite.
 func (server *Server) WithDB(db *sqlx.DB) *Server {
 	server.db = db
 	server.stmts = arborist.NewCachedStmts(db)
+	server.store = NewStore(db)
+	switch store := server.store.(type) {
+	case *PostgresStore:
+		store.metrics = server.metrics
+	case *SQLiteStore:
+		store.metrics = server.metrics
+	}
+	server.metrics.registerDB(db)
+	return server
+}
+
+// WithStore backs the server with any ConfigStore, such as a MemoryStore.
+func (server *Server) WithStore(store ConfigStore) *Server {
+	server.store = store
 	return server
 }
 
 func (server *Server) Init() (*Server, error) {
-	if server.db == nil {
+	if server.store == nil {
 		return nil, errors.New("gecko server initialized without database")
 	}
 	if server.jwtApp == nil {
 		return nil, errors.New("gecko server initialized without JWT app")
 	}
+	if server.authorizer == nil {
+		return nil, errors.New("gecko server initialized without authorizer")
+	}
 	if server.logger == nil {
 		return nil, errors.New("gecko server initialized without logger")
 	}
-	server.logger.Info("DB: %#v, JWTApp: %#v, Logger: %#v", server.db, server.jwtApp, server.logger)
+	server.logger.Info("Store: %T, JWTApp: %T", server.store, server.jwtApp)
 	return server, nil
 }
 
@@ -67,18 +142,53 @@ func (server *Server) MakeRouter() *iris.Application {
 	if router == nil {
 		server.logger.Error("Failed to initialize router")
 	}
-	router.Use(recoveryMiddleware)
+	// These run for every request, including ones that match no route.
+	router.UseRouter(requestIDMiddleware)
+	if server.accessLog != nil {
+		router.UseRouter(server.accessLog.middleware)
+	}
+	if len(server.cors.AllowedOrigins) > 0 {
+		router.UseRouter(server.cors.middleware)
+	}
+	router.Use(server.tracingMiddleware)
+	router.Use(server.metrics.middleware)
+	router.Use(server.recoveryMiddleware)
 	router.OnErrorCode(iris.StatusNotFound, handleNotFound)
 	router.Get("/health", server.handleHealth)
-	router.Get("/config/{configId}", server.handleConfigGET)
-	router.Put("/config/{configId}", server.handleConfigPUT)
-	router.Delete("/config/{configId}", server.handleConfigDELETE)
+	router.Get("/_status/live", server.handleLiveGET)
+	router.Get("/_status/ready", server.handleReadyGET)
+	router.Get("/metrics", server.metrics.handler())
+	router.Get("/_version", server.handleVersionGET)
+	router.Get("/schema/explorer-config", server.handleSchemaGET)
+
+	configRoutes := router.Party("/config", server.authMiddleware, server.auditMiddleware)
+	configRoutes.Get("/", server.handleConfigListGET)
+	configRoutes.Get("/{configId}", server.authzMiddleware(ActionRead), server.handleConfigGET)
+	configRoutes.Put("/{configId}", server.authzMiddleware(ActionUpdate), server.handleConfigPUT)
+	configRoutes.Patch("/{configId}", server.authzMiddleware(ActionUpdate), server.handleConfigPATCH)
+	configRoutes.Delete("/{configId}", server.authzMiddleware(ActionDelete), server.handleConfigDELETE)
+	configRoutes.Post("/{configId}/tabs", server.authzMiddleware(ActionUpdate), server.handleTabPOST)
+	configRoutes.Get("/{configId}/tabs/{tabTitle}", server.authzMiddleware(ActionRead), server.handleTabGET)
+	configRoutes.Put("/{configId}/tabs/{tabTitle}", server.authzMiddleware(ActionUpdate), server.handleTabPUT)
+	configRoutes.Delete("/{configId}/tabs/{tabTitle}", server.authzMiddleware(ActionUpdate), server.handleTabDELETE)
+	configRoutes.Get("/{configId}/versions", server.authzMiddleware(ActionRead), server.handleConfigVersionsGET)
+	configRoutes.Get("/{configId}/versions/{version:int}", server.authzMiddleware(ActionRead), server.handleConfigVersionGET)
+	configRoutes.Get("/{configId}/versions/{version:int}/diff/{otherVersion:int}", server.authzMiddleware(ActionRead), server.handleConfigVersionDiffGET)
+	configRoutes.Get("/{configId}/diff/{otherId}", server.authzMiddleware(ActionRead), server.handleConfigDiffGET)
+	configRoutes.Post("/{configId}/rollback/{version:int}", server.authzMiddleware(ActionUpdate), server.handleConfigRollbackPOST)
+	configRoutes.Post("/{configId}/restore", server.authzMiddleware(ActionDelete), server.handleConfigRestorePOST)
+
+	trashRoutes := router.Party("/trash", server.authMiddleware)
+	trashRoutes.Get("/", server.handleTrashGET)
+
+	auditRoutes := router.Party("/audit", server.authMiddleware)
+	auditRoutes.Get("/", server.handleAuditGET)
 
 	// Optionally keep UseRouter if needed, with safety checks
 	router.UseRouter(func(ctx iris.Context) {
 		req := ctx.Request()
 		if req == nil || req.URL == nil {
-			server.logger.Warning("Request or URL is nil")
+			server.requestLogger(ctx).Warning("Request or URL is nil")
 			ctx.StatusCode(http.StatusInternalServerError)
 			ctx.WriteString("Internal Server Error")
 			return
@@ -94,10 +204,11 @@ func (server *Server) MakeRouter() *iris.Application {
 	return router
 }
 
-func recoveryMiddleware(ctx iris.Context) {
+func (server *Server) recoveryMiddleware(ctx iris.Context) {
 	defer func() {
 		if r := recover(); r != nil {
-			ctx.Application().Logger().Errorf("panic recovered: %v", r)
+			server.metrics.panics.Inc()
+			server.requestLogger(ctx).Error("panic recovered: %v", r)
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.WriteString("Internal Server Error")
 		}
@@ -107,101 +218,478 @@ func recoveryMiddleware(ctx iris.Context) {
 
 func (server *Server) handleConfigGET(ctx iris.Context) {
 	configId := ctx.Params().Get("configId")
-	doc, err := configGET(server.db, configId)
+	doc, err := server.store.Get(ctx.Request().Context(), configId)
 	if doc == nil && err == nil {
 		msg := fmt.Sprintf("no configId found with configId: %s", configId)
 		errResponse := newErrorResponse(msg, 404, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
 	if err != nil {
 		msg := fmt.Sprintf("config query failed: %s", err.Error())
 		errResponse := newErrorResponse(msg, 500, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
-	server.logger.Info("%#v", doc)
+	ctx.Header("ETag", doc.ETag)
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, doc.ETag, true) {
+		ctx.StatusCode(http.StatusNotModified)
+		return
+	}
+	server.requestLogger(ctx).Debug("returning config %s version %d", doc.Name, doc.Version)
 	_ = jsonResponseFrom(doc, http.StatusOK).write(ctx)
 }
 
+// handleConfigDELETE moves a config to the trash. With `?hard=true` it deletes
+// the config and its versions for good instead, which also needs the purge
+// permission.
 func (server *Server) handleConfigDELETE(ctx iris.Context) {
 	configId := ctx.Params().Get("configId")
-	doc, err := configDELETE(server.db, configId)
-	if doc == false && err == nil {
+	deleteConfig, deleted := server.store.Delete, "DELETED"
+	if ctx.URLParamBoolDefault("hard", false) {
+		authorized, err := server.authorize(ctx, configId, ActionPurge)
+		if err != nil {
+			msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		if !authorized {
+			msg := fmt.Sprintf("not authorized to %s %s", ActionPurge, configResourcePath(configId))
+			errResponse := newErrorResponse(msg, http.StatusForbidden, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		deleteConfig, deleted = server.store.Purge, "PURGED"
+	}
+	doc, err := deleteConfig(ctx.Request().Context(), configId, preconditionFrom(ctx))
+	if doc == nil && err == nil {
 		msg := fmt.Sprintf("no configId found with configId: %s", configId)
 		errResponse := newErrorResponse(msg, 404, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		server.preconditionFailed(ctx, configId)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf("config query failed: %s", err.Error())
 		errResponse := newErrorResponse(msg, 500, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
 
-	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("DELETED: %s", configId)}
-	server.logger.Info("%#v", okmsg)
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("%s: %s", deleted, configId)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	// The response carries what was deleted, so a mistaken delete can be
+	// undone by writing it back.
+	okmsg["config"] = doc
 	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
 }
 
 func (server *Server) handleConfigPUT(ctx iris.Context) {
 	configId := ctx.Params().Get("configId")
-	data := []config.ConfigItem{}
 	body, err := ctx.GetBody()
 	if err != nil {
 		msg := fmt.Sprintf("GetBody() failed: %s", err.Error())
 		errResponse := newErrorResponse(msg, 500, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
-	if !json.Valid(body) {
-		msg := "Invalid JSON format"
-		errResponse := newErrorResponse(msg, 400, nil)
-		errResponse.log.write(server.logger)
+	server.metrics.putBodyBytes.Observe(float64(len(body)))
+	data, errResponse := server.decodeConfig(ctx, configId, body)
+	if errResponse != nil {
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
+	etag, err := server.store.Put(ctx.Request().Context(), configId, data, tokenInfoFrom(ctx).actor(), preconditionFrom(ctx))
+	if errors.Is(err, ErrPreconditionFailed) {
+		server.preconditionFailed(ctx, configId)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("configPut failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("ACCEPTED: %s", configId)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	ctx.Header("ETag", etag)
+	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
+}
+
+// decodeConfig turns a request body into a config and checks it the same way
+// for every write: it must unmarshal, have no unknown properties when decoding
+// strictly, match the schema and pass config.Validate.
+func (server *Server) decodeConfig(ctx iris.Context, configId string, body []byte) ([]config.ConfigItem, *ErrorResponse) {
+	data := []config.ConfigItem{}
+	if !json.Valid(body) {
+		return nil, newErrorResponse("Invalid JSON format", 400, nil)
+	}
 	errResponse := unmarshal(body, &data)
 	if errResponse != nil {
 		msg := fmt.Sprintf("body data unmarshal failed: %s", errResponse.err)
+		return nil, newErrorResponse(msg, 400, nil)
+	}
+	strict := server.strictDecoding || ctx.URLParamBoolDefault("strict", false)
+	if unknown := config.UnknownFields(data); strict && len(unknown) > 0 {
+		msg := fmt.Sprintf("config %s has unknown field(s): %s", configId, strings.Join(unknown, ", "))
+		return nil, newErrorResponse(msg, 400, nil).withDetails(unknown)
+	}
+	// The schema catches structural problems, such as a missing property or an
+	// unknown chartType, in the body as sent. Validate checks the config as a
+	// whole. Both report some of the same things, so a problem at or below a
+	// path the schema already complained about is left out.
+	var raw any
+	_ = json.Unmarshal(body, &raw)
+	problems := config.ExplorerConfigSchema().Validate(raw)
+	schemaProblems := len(problems)
+	for _, problem := range config.Validate(data) {
+		reported := false
+		for _, schemaProblem := range problems[:schemaProblems] {
+			rest, found := strings.CutPrefix(problem.Path, schemaProblem.Path)
+			if found && (rest == "" || rest[0] == '.' || rest[0] == '[') {
+				reported = true
+				break
+			}
+		}
+		if !reported {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		msg := fmt.Sprintf("config %s is invalid: %d problem(s) found", configId, len(problems))
+		return nil, newErrorResponse(msg, http.StatusUnprocessableEntity, nil).withDetails(problems)
+	}
+	return data, nil
+}
+
+// handleConfigPATCH applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC
+// 6902) to a stored config.
+func (server *Server) handleConfigPATCH(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	body, err := ctx.GetBody()
+	if err != nil {
+		msg := fmt.Sprintf("GetBody() failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	var apply func(doc any) (any, error)
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	switch mediaType {
+	case MergePatchMediaType:
+		patch, err := decodeJSON(body)
+		if err != nil {
+			errResponse := newErrorResponse(fmt.Sprintf("invalid merge patch: %s", err), 400, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		apply = func(doc any) (any, error) { return mergePatch(doc, patch), nil }
+	case JSONPatchMediaType:
+		operations, err := parseJSONPatch(body)
+		if err != nil {
+			errResponse := newErrorResponse(fmt.Sprintf("invalid JSON patch: %s", err), 400, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		apply = func(doc any) (any, error) { return applyJSONPatch(doc, operations) }
+	default:
+		msg := fmt.Sprintf("unsupported patch format %q, use %s or %s", mediaType, MergePatchMediaType, JSONPatchMediaType)
+		errResponse := newErrorResponse(msg, http.StatusUnsupportedMediaType, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		ctx.Header("Accept-Patch", MergePatchMediaType+", "+JSONPatchMediaType)
+		_ = errResponse.write(ctx)
+		return
+	}
+
+	etag, ok := server.updateConfig(ctx, configId, apply)
+	if !ok {
+		return
+	}
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("PATCHED: %s", configId)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	ctx.Header("ETag", etag)
+	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
+}
+
+// updateConfig stores what apply makes of the stored config, given as decoded
+// JSON, if it passes the same checks as a PUT. Reading, applying and writing
+// happen in one transaction, so concurrent writes cannot get lost. It returns
+// the new ETag, or writes an error response and returns false.
+func (server *Server) updateConfig(ctx iris.Context, configId string, apply func(doc any) (any, error)) (string, bool) {
+	// configResponse is set when the updated config fails the checks.
+	var configResponse *ErrorResponse
+	update := func(content []byte) ([]config.ConfigItem, error) {
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = apply(doc)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		data, errResponse := server.decodeConfig(ctx, configId, updated)
+		if errResponse != nil {
+			configResponse = errResponse
+			return nil, errors.New(errResponse.HTTPError.Message)
+		}
+		return data, nil
+	}
+	etag, err := server.store.Patch(ctx.Request().Context(), configId, update, tokenInfoFrom(ctx).actor(), preconditionFrom(ctx))
+	var errResponse *ErrorResponse
+	switch {
+	case configResponse != nil:
+		errResponse = configResponse
+	case errors.Is(err, ErrPreconditionFailed):
+		server.preconditionFailed(ctx, configId)
+		return "", false
+	case errors.Is(err, ErrPatchConflict):
+		errResponse = newErrorResponse(err.Error(), http.StatusConflict, nil)
+	case errors.Is(err, ErrTabNotFound):
+		errResponse = newErrorResponse(err.Error(), 404, nil)
+	case err != nil:
+		msg := fmt.Sprintf("configPatch failed: %s", err.Error())
+		errResponse = newErrorResponse(msg, 500, nil)
+	case etag == "":
+		msg := fmt.Sprintf("no configId found with configId: %s", configId)
+		errResponse = newErrorResponse(msg, 404, nil)
+	}
+	if errResponse != nil {
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return "", false
+	}
+	return etag, true
+}
+
+// handleSchemaGET serves the JSON Schema that PUT validates configs against.
+func (server *Server) handleSchemaGET(ctx iris.Context) {
+	_ = jsonResponseFrom(config.ExplorerConfigSchema(), http.StatusOK).write(ctx)
+}
+
+// handleConfigListGET lists stored configs a page at a time. Configs the
+// caller may not read are left out of the page.
+func (server *Server) handleConfigListGET(ctx iris.Context) {
+	limit := ctx.URLParamIntDefault("limit", defaultListLimit)
+	if limit < 1 || limit > maxListLimit {
+		msg := fmt.Sprintf("limit must be between 1 and %d", maxListLimit)
 		errResponse := newErrorResponse(msg, 400, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
-	err = configPUT(server.db, configId, data)
+	after, err := decodeCursor(ctx.URLParam("cursor"))
 	if err != nil {
-		msg := fmt.Sprintf("configPut failed: %s", err.Error())
+		errResponse := newErrorResponse("invalid cursor", 400, &err)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	query := ConfigListQuery{
+		After:    after,
+		Prefix:   ctx.URLParam("prefix"),
+		DataType: ctx.URLParam("dataType"),
+		// fetch one extra row to find out whether there is another page
+		Limit: limit + 1,
+	}
+	authorize, err := server.configAuthorizer(ctx, ActionRead)
+	if err != nil {
+		msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	// Configs the caller may not read are left out, so keep fetching until
+	// the page is full or there is nothing left.
+	configs := []ConfigSummary{}
+	more := false
+	for !more {
+		summaries, err := server.store.List(ctx.Request().Context(), query)
+		if err != nil {
+			msg := fmt.Sprintf("config list query failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, 500, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		for _, summary := range summaries {
+			authorized, err := authorize(summary.Name)
+			if err != nil {
+				msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+				errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+				errResponse.log.write(server.requestLogger(ctx))
+				_ = errResponse.write(ctx)
+				return
+			}
+			if !authorized {
+				continue
+			}
+			if len(configs) == limit {
+				more = true
+				break
+			}
+			configs = append(configs, summary)
+		}
+		if len(summaries) < query.Limit {
+			break
+		}
+		query.After = summaries[len(summaries)-1].Name
+	}
+	nextCursor := ""
+	if more {
+		nextCursor = encodeCursor(configs[limit-1].Name)
+	}
+	response := map[string]any{"configs": configs, "nextCursor": nextCursor}
+	_ = jsonResponseFrom(response, http.StatusOK).write(ctx)
+}
+
+func (server *Server) handleConfigVersionsGET(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	versions, err := server.store.Versions(ctx.Request().Context(), configId)
+	if err != nil {
+		msg := fmt.Sprintf("config versions query failed: %s", err.Error())
 		errResponse := newErrorResponse(msg, 500, nil)
-		errResponse.log.write(server.logger)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if len(versions) == 0 {
+		msg := fmt.Sprintf("no versions found with configId: %s", configId)
+		errResponse := newErrorResponse(msg, 404, nil)
+		errResponse.log.write(server.requestLogger(ctx))
 		_ = errResponse.write(ctx)
 		return
 	}
+	_ = jsonResponseFrom(versions, http.StatusOK).write(ctx)
+}
 
-	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("ACCEPTED: %s", configId)}
-	server.logger.Info("%#v", okmsg)
-	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
+func (server *Server) handleConfigVersionGET(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	version := ctx.Params().GetIntDefault("version", 0)
+	doc, err := server.store.Version(ctx.Request().Context(), configId, version)
+	if doc == nil && err == nil {
+		msg := fmt.Sprintf("no version %d found with configId: %s", version, configId)
+		errResponse := newErrorResponse(msg, 404, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("config version query failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	_ = jsonResponseFrom(doc, http.StatusOK).write(ctx)
+}
+
+func (server *Server) handleConfigRollbackPOST(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	version := ctx.Params().GetIntDefault("version", 0)
+	doc, err := server.store.Rollback(ctx.Request().Context(), configId, version, tokenInfoFrom(ctx).actor(), preconditionFrom(ctx))
+	if doc == nil && err == nil {
+		msg := fmt.Sprintf("no version %d found with configId: %s", version, configId)
+		errResponse := newErrorResponse(msg, 404, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		server.preconditionFailed(ctx, configId)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("config rollback failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	server.requestLogger(ctx).Info("rolled back %s to version %d as version %d", configId, version, doc.Version)
+	ctx.Header("ETag", quoteETag(doc.ContentHash))
+	_ = jsonResponseFrom(doc, http.StatusOK).write(ctx)
+}
+
+func (server *Server) preconditionFailed(ctx iris.Context, configId string) {
+	msg := fmt.Sprintf("precondition failed: %s was modified or does not match If-Match/If-None-Match", configId)
+	errResponse := newErrorResponse(msg, http.StatusPreconditionFailed, nil)
+	errResponse.log.write(server.requestLogger(ctx))
+	_ = errResponse.write(ctx)
 }
 
 func (server *Server) handleHealth(ctx iris.Context) {
-	server.logger.Info("Entering handleHealth")
-	err := server.db.Ping()
+	server.requestLogger(ctx).Debug("Entering handleHealth")
+	err := server.store.Ping(ctx.Request().Context())
 	if err != nil {
-		server.logger.Error("Database ping failed: %v", err)
+		server.requestLogger(ctx).Error("Database ping failed: %v", err)
 		response := newErrorResponse("database unavailable", 500, nil)
 		_ = response.write(ctx)
 		return
 	}
-	server.logger.Info("Health check passed")
+	server.requestLogger(ctx).Debug("Health check passed")
 	_ = jsonResponseFrom("Healthy", http.StatusOK).write(ctx)
 }
 
+// handleVersionGET describes the running build of gecko and the storage it
+// uses. The schema version is null for stores without migrations.
+func (server *Server) handleVersionGET(ctx iris.Context) {
+	response := struct {
+		version.Info
+		Storage       string `json:"storage"`
+		SchemaVersion *int   `json:"schemaVersion"`
+	}{
+		Info:    version.Get(),
+		Storage: server.storageBackend(),
+	}
+	if server.db != nil {
+		schemaVersion, err := SchemaVersion(server.db)
+		if err != nil {
+			msg := fmt.Sprintf("schema version query failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, 500, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		response.SchemaVersion = &schemaVersion
+	}
+	_ = jsonResponseFrom(response, http.StatusOK).write(ctx)
+}
+
+// storageBackend names the kind of store the server uses.
+func (server *Server) storageBackend() string {
+	switch server.store.(type) {
+	case *PostgresStore:
+		return DialectPostgres
+	case *SQLiteStore:
+		return DialectSQLite
+	case *MemoryStore:
+		return "memory"
+	}
+	return fmt.Sprintf("%T", server.store)
+}
+
 func handleNotFound(ctx iris.Context) {
 	response := struct {
 		Error struct {
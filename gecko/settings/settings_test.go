@@ -0,0 +1,170 @@
+package settings
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func load(t *testing.T, args []string, env map[string]string) (*Settings, error) {
+	flags := flag.NewFlagSet("gecko", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	return Load(flags, args, lookupEnv)
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	settings, err := load(t, nil, nil)
+	assert.NoError(t, err)
+	expected := Defaults()
+	expected.Storage.Backend = StoragePostgres
+	assert.Equal(t, expected, *settings)
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "gecko.yaml", `
+server:
+  port: 8080
+  readTimeout: 30s
+storage:
+  url: sqlite:///var/lib/gecko.db
+  maxOpenConns: 4
+auth:
+  jwks: https://file.example.org/jwks
+log:
+  level: debug
+cors:
+  allowedOrigins: [https://portal.example.org]
+`)
+	env := map[string]string{
+		"GECKO_CONFIG":    path,
+		"GECKO_LOG_LEVEL": "warning",
+		"GECKO_PORT":      "9090",
+		"JWKS_ENDPOINT":   "https://legacy.example.org/jwks",
+	}
+	settings, err := load(t, []string{"-port", "7070"}, env)
+	assert.NoError(t, err)
+	// flags win over the environment, which wins over the file
+	assert.Equal(t, uint(7070), settings.Server.Port)
+	assert.Equal(t, "warning", settings.Log.Level)
+	assert.Equal(t, 30*time.Second, settings.Server.ReadTimeout)
+	assert.Equal(t, 4, settings.Storage.MaxOpenConns)
+	assert.Equal(t, []string{"https://portal.example.org"}, settings.CORS.AllowedOrigins)
+	assert.Equal(t, StorageSQLite, settings.Storage.Backend)
+	assert.Equal(t, path, settings.ConfigFile)
+	// $JWKS_ENDPOINT is still read, as an environment variable
+	assert.Equal(t, "https://legacy.example.org/jwks", settings.Auth.JWKS)
+	// and what is not set anywhere keeps its default
+	assert.Equal(t, 10*time.Second, settings.Server.WriteTimeout)
+
+	// but $GECKO_JWKS wins over it
+	env["GECKO_JWKS"] = "https://env.example.org/jwks"
+	settings, err = load(t, []string{"-jwks", "https://flag.example.org/jwks"}, env)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://flag.example.org/jwks", settings.Auth.JWKS)
+	settings, err = load(t, nil, env)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://env.example.org/jwks", settings.Auth.JWKS)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "gecko.toml", `
+strictDecoding = true
+
+[server]
+shutdownGracePeriod = "45s"
+trustedProxies = ["10.0.0.0/8"]
+
+[storage]
+backend = "memory"
+
+[auth]
+mode = "jwt"
+`)
+	settings, err := load(t, []string{"-config", path, "-access-log-skip", "/health,/metrics"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, settings.StrictDecoding)
+	assert.Equal(t, 45*time.Second, settings.Server.ShutdownGracePeriod)
+	assert.Equal(t, []string{"10.0.0.0/8"}, settings.Server.TrustedProxies)
+	assert.Equal(t, StorageMemory, settings.Storage.Backend)
+	assert.Equal(t, AuthModeJWT, settings.Auth.Mode)
+	assert.Equal(t, []string{"/health", "/metrics"}, settings.Log.AccessLogSkip)
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"unknown yaml key": {args: []string{"-config", writeFile(t, "typo.yaml", "server:\n  prot: 80\n")}},
+		"unknown toml key": {args: []string{"-config", writeFile(t, "typo.toml", "[server]\nprot = 80\n")}},
+		"unknown file":     {args: []string{"-config", writeFile(t, "gecko.json", "{}")}},
+		"missing file":     {args: []string{"-config", filepath.Join(t.TempDir(), "gecko.yaml")}},
+		"invalid env":      {env: map[string]string{"GECKO_READ_TIMEOUT": "soon"}},
+		"invalid flag":     {args: []string{"-port", "http"}},
+		"backend mismatch": {args: []string{"-storage", "postgres", "-db", "sqlite://gecko.db"}},
+		"memory with url":  {args: []string{"-storage", "memory", "-db", "postgresql://localhost/gecko"}},
+		"sqlite, no path":  {args: []string{"-storage", "sqlite"}},
+		"unknown backend":  {args: []string{"-storage", "mongo"}},
+		"unknown auth":     {args: []string{"-auth-mode", "none"}},
+		"key without cert": {args: []string{"-tls-key-file", "key.pem"}},
+		"old TLS":          {args: []string{"-tls-min-version", "1.0"}},
+		"any origin with credentials": {
+			args: []string{"-cors-allowed-origins", "https://portal.example.org,*", "-cors-allow-credentials"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(t, test.args, test.env)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadSQLitePath(t *testing.T) {
+	settings, err := load(t, []string{"-storage", "sqlite", "-db", "/var/lib/gecko.db"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlite:///var/lib/gecko.db", settings.Storage.URL)
+}
+
+func TestRedacted(t *testing.T) {
+	for url, redacted := range map[string]string{
+		"postgresql://gecko:s3cret@db:5432/gecko?sslmode=disable": "postgresql://gecko:xxxxx@db:5432/gecko?sslmode=disable",
+		"host=db user=gecko password=s3cret dbname=gecko":         "host=db user=gecko password=xxxxx dbname=gecko",
+		"host=db password='s3 cret' dbname=gecko":                 "host=db password=xxxxx dbname=gecko",
+		"sqlite:///var/lib/gecko.db":                              "sqlite:///var/lib/gecko.db",
+	} {
+		settings := Defaults()
+		settings.Storage.URL = url
+		assert.Equal(t, redacted, settings.Redacted().Storage.URL)
+		assert.Equal(t, url, settings.Storage.URL)
+	}
+}
+
+func TestPrintedSettingsLoad(t *testing.T) {
+	settings := Defaults()
+	settings.Storage.Backend = StoragePostgres
+	settings.Server.IdleTimeout = 90 * time.Second
+	out, err := yaml.Marshal(settings)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "idleTimeout: 1m30s")
+
+	loaded, err := load(t, []string{"-config", writeFile(t, "printed.yaml", string(out))}, nil)
+	assert.NoError(t, err)
+	loaded.ConfigFile = ""
+	assert.Equal(t, settings, *loaded)
+}
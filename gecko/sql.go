@@ -1,72 +1,597 @@
 package gecko
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ACED-IDP/gecko/gecko/config"
 	"github.com/jmoiron/sqlx"
 )
 
 type Document struct {
-	ID      int             `db:"id"`
-	Name    string          `db:"name"`
-	Content json.RawMessage `db:"content"` // Store JSON as raw bytes
+	ID        int             `db:"id"`
+	Name      string          `db:"name"`
+	Content   json.RawMessage `db:"content"` // Store JSON as raw bytes
+	Version   int             `db:"version"`
+	CreatedAt time.Time       `db:"created_at"`
+	UpdatedAt time.Time       `db:"updated_at"`
+	UpdatedBy string          `db:"updated_by"`
 }
 
-func configGET(db *sqlx.DB, name string) (map[string]any, error) {
-	stmt := "SELECT name, content FROM documents WHERE name=$1"
+// documentColumns are the columns of `documents` that make up a Document.
+const documentColumns = "id, name, content, version, created_at, updated_at, updated_by"
+
+// stored decodes the document into a StoredConfig.
+func (doc *Document) stored() (*StoredConfig, error) {
+	var content []config.ConfigItem
+	err := json.Unmarshal(doc.Content, &content)
+	if err != nil {
+		return nil, err
+	}
+	etag, err := configETag(content)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredConfig{
+		ID:        doc.ID,
+		Name:      doc.Name,
+		Content:   content,
+		Version:   doc.Version,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+		UpdatedBy: doc.UpdatedBy,
+		ETag:      etag,
+	}, nil
+}
+
+// DocumentVersion is one entry in the append-only history of a document.
+// Every write to `documents` adds a version; versions are never modified.
+type DocumentVersion struct {
+	Name        string          `db:"name" json:"name"`
+	Version     int             `db:"version" json:"version"`
+	Content     json.RawMessage `db:"content" json:"content,omitempty"`
+	ContentHash string          `db:"content_hash" json:"contentHash"`
+	Author      string          `db:"author" json:"author"`
+	CreatedAt   time.Time       `db:"created_at" json:"createdAt"`
+}
+
+func configGET(ctx context.Context, db *sqlx.DB, name string) (*StoredConfig, error) {
+	stmt := "SELECT " + documentColumns + " FROM documents WHERE name=$1 AND deleted_at IS NULL"
 	doc := &Document{}
-	err := db.Get(doc, stmt, name)
+	err := tracedGet(ctx, db, doc, stmt, name)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	return doc.stored()
+}
 
-	var content []config.ConfigItem
-	err = json.Unmarshal(doc.Content, &content)
+// configDELETE moves the document to the trash. Of two concurrent deletes, only
+// the first finds the document; the second waits for its row lock and then
+// matches nothing.
+func configDELETE(ctx context.Context, db *sqlx.DB, name string, precondition Precondition) (*StoredConfig, error) {
+	stmt := `
+                UPDATE documents SET deleted_at = now()
+                WHERE name = $1 AND deleted_at IS NULL
+                RETURNING ` + documentColumns + `;
+        `
+	return removeDocument(ctx, db, AuditActionDelete, stmt, name, precondition)
+}
+
+// removeDocument runs stmt, an UPDATE or DELETE of the document name that
+// returns its row, and commits it, recorded as action, if the precondition
+// holds for the content that was removed. A purge deletes the versions too.
+func removeDocument(ctx context.Context, db *sqlx.DB, action string, stmt string, name string, precondition Precondition) (*StoredConfig, error) {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	return map[string]any{"content": content, "id": doc.ID, "Name": doc.Name}, nil
-}
-func configDELETE(db *sqlx.DB, name string) (bool, error) {
-	// First, let's check if the config even exists.
-	stmt := "SELECT name FROM documents WHERE name=$1"
+	defer tx.Rollback()
 	doc := &Document{}
-	err := db.Get(doc, stmt, name)
+	err = tracedGet(ctx, tx, doc, stmt, name)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
+			return nil, nil
 		}
-		return false, err
+		return nil, err
 	}
+	stored, err := doc.stored()
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(stored.ETag, true) {
+		return nil, ErrPreconditionFailed
+	}
+	content, err := canonicalContent(stored.Content)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAudit(ctx, tx, action, name, content, nil)
+	if err != nil {
+		return nil, err
+	}
+	if action == AuditActionPurge {
+		err = deleteVersions(ctx, tx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
 
-	deleteStmt := "DELETE FROM documents WHERE name=$1"
-	_, err = db.Exec(deleteStmt, name)
+// deleteVersions deletes the history of a purged document, so that its
+// content cannot be read back through the versions.
+func deleteVersions(ctx context.Context, tx *sqlx.Tx, name string) error {
+	_, err := tracedExec(ctx, tx, "DELETE FROM document_versions WHERE name = $1", name)
+	return err
+}
+
+// configPUT stores the config if the precondition holds and returns the
+// ETag of the stored content.
+func configPUT(ctx context.Context, db *sqlx.DB, name string, data []config.ConfigItem, author string, precondition Precondition) (string, error) {
+	jsonData, err := canonicalContent(data)
 	if err != nil {
-		return false, err
+		return "", err
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	current, exists, err := lockDocumentContent(ctx, tx, name)
+	if err != nil {
+		return "", err
+	}
+	if !precondition.allows(quoteETag(contentHash(current)), exists) {
+		return "", ErrPreconditionFailed
+	}
+	_, err = putDocument(ctx, tx, name, jsonData, author, precondition.createOnly())
+	if err != nil {
+		return "", err
+	}
+	err = recordAudit(ctx, tx, AuditActionPut, name, current, jsonData)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return quoteETag(contentHash(jsonData)), nil
+}
+
+// configPATCH applies patch to the content of the locked document and stores
+// the result.
+func configPATCH(ctx context.Context, db *sqlx.DB, name string, patch func(content []byte) ([]config.ConfigItem, error), author string, precondition Precondition) (string, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	current, exists, err := lockDocumentContent(ctx, tx, name)
+	if err != nil || !exists {
+		return "", err
+	}
+	if !precondition.allows(quoteETag(contentHash(current)), exists) {
+		return "", ErrPreconditionFailed
+	}
+	data, err := patch(current)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	_, err = putDocument(ctx, tx, name, jsonData, author, false)
+	if err != nil {
+		return "", err
+	}
+	err = recordAudit(ctx, tx, AuditActionPatch, name, current, jsonData)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
 	}
-	return true, nil
+	return quoteETag(contentHash(jsonData)), nil
 }
 
-func configPUT(db *sqlx.DB, name string, data []config.ConfigItem) error {
+// lockDocumentContent locks the document row for the rest of the transaction
+// and returns its content in canonical form. A document in the trash does not
+// exist, although its row is locked.
+func lockDocumentContent(ctx context.Context, tx *sqlx.Tx, name string) ([]byte, bool, error) {
+	stmt := "SELECT content, deleted_at IS NOT NULL AS deleted FROM documents WHERE name=$1 FOR UPDATE"
+	row := struct {
+		Content json.RawMessage `db:"content"`
+		Deleted bool            `db:"deleted"`
+	}{}
+	err := tracedGet(ctx, tx, &row, stmt, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if row.Deleted {
+		return nil, false, nil
+	}
+	canonical, err := canonicalJSONB(row.Content)
+	if err != nil {
+		return nil, false, err
+	}
+	return canonical, true, nil
+}
+
+// canonicalJSONB puts content read from a JSONB column, which does not keep
+// the key order the content was written with, in canonical form.
+func canonicalJSONB(raw json.RawMessage) ([]byte, error) {
+	var content []config.ConfigItem
+	err := json.Unmarshal(raw, &content)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalContent(content)
+}
+
+// putDocument upserts the document, taking it out of the trash, records the
+// write as a new version and stamps the document with it. The upsert locks the document row, so concurrent
+// writers to the same name are serialized and always get distinct version
+// numbers. With createOnly, an existing document is left alone and
+// ErrPreconditionFailed is returned; this covers the race where another writer
+// creates the document after lockDocument found nothing to lock.
+func putDocument(ctx context.Context, tx *sqlx.Tx, name string, content []byte, author string, createOnly bool) (int, error) {
 	stmt := `
                 INSERT INTO documents (name, content)
                 VALUES ($1, $2)
                 ON CONFLICT (name)
-                DO UPDATE SET content = $2;
+                DO UPDATE SET content = $2, deleted_at = NULL;
         `
-	jsonData, err := json.Marshal(data)
+	if createOnly {
+		stmt = `
+                INSERT INTO documents (name, content)
+                VALUES ($1, $2)
+                ON CONFLICT (name)
+                DO UPDATE SET content = $2, deleted_at = NULL
+                WHERE documents.deleted_at IS NOT NULL;
+        `
+	}
+	result, err := tracedExec(ctx, tx, stmt, name, content)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if createOnly {
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if inserted == 0 {
+			return 0, ErrPreconditionFailed
+		}
+	}
+	versionStmt := `
+                INSERT INTO document_versions (name, version, content, content_hash, author)
+                SELECT $1, COALESCE(MAX(version), 0) + 1, $2::jsonb, $3, $4
+                FROM document_versions
+                WHERE name = $1
+                RETURNING version, created_at;
+        `
+	written := struct {
+		Version   int       `db:"version"`
+		CreatedAt time.Time `db:"created_at"`
+	}{}
+	err = tracedGet(ctx, tx, &written, versionStmt, name, content, contentHash(content), author)
+	if err != nil {
+		return 0, err
+	}
+	stampStmt := "UPDATE documents SET version = $2, updated_at = $3, updated_by = $4 WHERE name = $1"
+	_, err = tracedExec(ctx, tx, stampStmt, name, written.Version, written.CreatedAt, author)
+	if err != nil {
+		return 0, err
+	}
+	return written.Version, nil
+}
+
+func configTRASH(ctx context.Context, db *sqlx.DB) ([]TrashedConfig, error) {
+	stmt := `
+                SELECT name, deleted_at
+                FROM documents
+                WHERE deleted_at IS NOT NULL
+                ORDER BY deleted_at DESC, name;
+        `
+	trashed := []TrashedConfig{}
+	err := tracedSelect(ctx, db, &trashed, stmt)
+	if err != nil {
+		return nil, err
+	}
+	return trashed, nil
+}
+
+func configRESTORE(ctx context.Context, db *sqlx.DB, name string) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
 	}
-	_, err = db.Exec(stmt, name, jsonData)
+	defer tx.Rollback()
+	stmt := "UPDATE documents SET deleted_at = NULL WHERE name = $1 AND deleted_at IS NOT NULL RETURNING content"
+	var raw json.RawMessage
+	err = tracedGet(ctx, tx, &raw, stmt, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	content, err := canonicalJSONB(raw)
+	if err != nil {
+		return false, err
+	}
+	err = recordAudit(ctx, tx, AuditActionRestore, name, nil, content)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// configPURGE deletes the document for good. The precondition applies to the
+// content whether the document is in the trash or not.
+func configPURGE(ctx context.Context, db *sqlx.DB, name string, precondition Precondition) (*StoredConfig, error) {
+	stmt := "DELETE FROM documents WHERE name = $1 RETURNING " + documentColumns
+	return removeDocument(ctx, db, AuditActionPurge, stmt, name, precondition)
+}
+
+func configPURGETRASH(ctx context.Context, db *sqlx.DB, before time.Time) ([]string, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt := "DELETE FROM documents WHERE deleted_at < $1 RETURNING name, content"
+	purged := []struct {
+		Name    string          `db:"name"`
+		Content json.RawMessage `db:"content"`
+	}{}
+	err = tracedSelect(ctx, tx, &purged, stmt, before)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(purged, func(i, j int) bool { return purged[i].Name < purged[j].Name })
+	names := make([]string, len(purged))
+	for i, doc := range purged {
+		content, err := canonicalJSONB(doc.Content)
+		if err != nil {
+			return nil, err
+		}
+		err = recordAudit(ctx, tx, AuditActionPurge, doc.Name, content, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = deleteVersions(ctx, tx, doc.Name)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = doc.Name
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func configVersionsGET(ctx context.Context, db *sqlx.DB, name string) ([]DocumentVersion, error) {
+	stmt := `
+                SELECT name, version, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = $1
+                ORDER BY version DESC;
+        `
+	versions := []DocumentVersion{}
+	err := tracedSelect(ctx, db, &versions, stmt, name)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func configVersionGET(ctx context.Context, db *sqlx.DB, name string, version int) (*DocumentVersion, error) {
+	stmt := `
+                SELECT name, version, content, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = $1 AND version = $2;
+        `
+	doc := &DocumentVersion{}
+	err := tracedGet(ctx, db, doc, stmt, name, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// configROLLBACK writes the content of an earlier version back as the current
+// document. History is kept intact; the rollback itself becomes a new version.
+func configROLLBACK(ctx context.Context, db *sqlx.DB, name string, version int, author string, precondition Precondition) (*DocumentVersion, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt := "SELECT content FROM document_versions WHERE name = $1 AND version = $2"
+	var raw json.RawMessage
+	err = tracedGet(ctx, tx, &raw, stmt, name, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var data []config.ConfigItem
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, err
+	}
+	content, err := canonicalContent(data)
+	if err != nil {
+		return nil, err
+	}
+	current, exists, err := lockDocumentContent(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(quoteETag(contentHash(current)), exists) {
+		return nil, ErrPreconditionFailed
+	}
+	newVersion, err := putDocument(ctx, tx, name, content, author, false)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAudit(ctx, tx, AuditActionRollback, name, current, content)
+	if err != nil {
+		return nil, err
+	}
+	doc := &DocumentVersion{}
+	stmt = `
+                SELECT name, version, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = $1 AND version = $2;
+        `
+	err = tracedGet(ctx, tx, doc, stmt, name, newVersion)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// recordAudit records the change of name from before to after, made in tx;
+// see newAuditEvent.
+func recordAudit(ctx context.Context, tx *sqlx.Tx, action string, name string, before []byte, after []byte) error {
+	event, err := newAuditEvent(ctx, action, name, before, after)
 	if err != nil {
 		return err
 	}
-	return nil
+	stmt := `
+                INSERT INTO audit_events (created_at, action, config_id, actor, source_ip, request_id, before_hash, after_hash, diff)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::jsonb);
+        `
+	_, err = tracedExec(ctx, tx, stmt,
+		event.Time, event.Action, event.ConfigID, event.Actor, event.SourceIP, event.RequestID,
+		event.BeforeHash, event.AfterHash, string(event.Diff),
+	)
+	return err
+}
+
+func auditEventsGET(ctx context.Context, db *sqlx.DB, query AuditQuery) ([]AuditEvent, error) {
+	stmt := `
+                SELECT ` + auditEventColumns + `
+                FROM audit_events
+                WHERE id > $1
+                    AND ($2 = '' OR config_id = $2)
+                    AND ($3 = '' OR actor = $3)
+                    AND created_at >= $4
+                ORDER BY id
+                LIMIT $5;
+        `
+	events := []AuditEvent{}
+	err := tracedSelect(ctx, db, &events, stmt, query.After, query.ConfigID, query.Actor, query.Since, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ConfigSummary describes a stored config without its content.
+type ConfigSummary struct {
+	Name      string     `db:"name" json:"name"`
+	Size      int        `db:"size" json:"size"`
+	Tabs      int        `db:"tabs" json:"tabs"`
+	DataTypes stringList `db:"data_types" json:"dataTypes"`
+	UpdatedAt *time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// ConfigListQuery selects a page of configs ordered by name. After is the
+// name of the last config on the previous page.
+type ConfigListQuery struct {
+	After    string
+	Prefix   string
+	DataType string
+	Limit    int
+}
+
+func configLIST(ctx context.Context, db *sqlx.DB, query ConfigListQuery) ([]ConfigSummary, error) {
+	stmt := `
+                SELECT
+                    d.name,
+                    octet_length(d.content::text) AS size,
+                    jsonb_array_length(d.content) AS tabs,
+                    COALESCE((
+                        SELECT jsonb_agg(DISTINCT item->'guppyConfig'->>'dataType')
+                        FROM jsonb_array_elements(d.content) AS item
+                        WHERE item->'guppyConfig'->>'dataType' IS NOT NULL
+                    ), '[]'::jsonb) AS data_types,
+                    d.updated_at
+                FROM documents AS d
+                WHERE d.deleted_at IS NULL
+                    AND d.name > $1
+                    AND d.name LIKE $2 ESCAPE '\'
+                    AND ($3 = '' OR d.content @> jsonb_build_array(
+                        jsonb_build_object('guppyConfig', jsonb_build_object('dataType', $3::text))
+                    ))
+                ORDER BY d.name
+                LIMIT $4;
+        `
+	summaries := []ConfigSummary{}
+	err := tracedSelect(ctx, db, &summaries, stmt, query.After, likePrefix(query.Prefix), query.DataType, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// likePrefix escapes the LIKE wildcards in prefix and appends `%`.
+func likePrefix(prefix string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return escaper.Replace(prefix) + "%"
+}
+
+// stringList scans a JSON array of strings from the database.
+type stringList []string
+
+func (list *stringList) Scan(src any) error {
+	switch value := src.(type) {
+	case []byte:
+		return json.Unmarshal(value, list)
+	case string:
+		return json.Unmarshal([]byte(value), list)
+	case nil:
+		*list = stringList{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into stringList", src)
 }
@@ -0,0 +1,581 @@
+package gecko
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	sqlx.BindDriver(DialectSQLite, sqlx.QUESTION)
+}
+
+// OpenSQLite opens (creating if needed) the SQLite database at path.
+// Transactions begin with BEGIN IMMEDIATE so that a transaction that reads a
+// document before writing it holds the write lock throughout, like the row
+// locks PostgresStore takes.
+func OpenSQLite(path string) (*sqlx.DB, error) {
+	params := url.Values{}
+	params.Add("_txlock", "immediate")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	return sqlx.Open(DialectSQLite, "file:"+path+"?"+params.Encode())
+}
+
+// sqliteDocument is Document with the content scanned as text, which is how
+// SQLite returns it.
+type sqliteDocument struct {
+	ID        int        `db:"id"`
+	Name      string     `db:"name"`
+	Content   string     `db:"content"`
+	Version   int        `db:"version"`
+	CreatedAt sqliteTime `db:"created_at"`
+	UpdatedAt sqliteTime `db:"updated_at"`
+	UpdatedBy string     `db:"updated_by"`
+}
+
+// stored decodes the document into a StoredConfig. Content is always written
+// in canonical form, so it can be hashed as stored.
+func (doc *sqliteDocument) stored() (*StoredConfig, error) {
+	var content []config.ConfigItem
+	err := json.Unmarshal([]byte(doc.Content), &content)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredConfig{
+		ID:        doc.ID,
+		Name:      doc.Name,
+		Content:   content,
+		Version:   doc.Version,
+		CreatedAt: doc.CreatedAt.Time,
+		UpdatedAt: doc.UpdatedAt.Time,
+		UpdatedBy: doc.UpdatedBy,
+		ETag:      quoteETag(contentHash([]byte(doc.Content))),
+	}, nil
+}
+
+// SQLiteStore is a ConfigStore for single-node deployments and local
+// development. It uses the tables from migrations/sqlite, which mirror the
+// Postgres ones with the JSON content kept as text.
+type SQLiteStore struct {
+	db *sqlx.DB
+	// metrics, if set, times each method under the name of the Postgres
+	// function it matches.
+	metrics *Metrics
+}
+
+func NewSQLiteStore(db *sqlx.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (store *SQLiteStore) Get(ctx context.Context, name string) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configGET")()
+	stmt := "SELECT " + documentColumns + " FROM documents WHERE name = ? AND deleted_at IS NULL"
+	doc := sqliteDocument{}
+	err := tracedGet(ctx, store.db, &doc, stmt, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc.stored()
+}
+
+func (store *SQLiteStore) Put(ctx context.Context, name string, data []config.ConfigItem, author string, precondition Precondition) (string, error) {
+	defer store.metrics.timeQuery("configPUT")()
+	content, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	current, exists, err := sqliteContent(ctx, tx, name)
+	if err != nil {
+		return "", err
+	}
+	if !precondition.allows(quoteETag(contentHash(current)), exists) {
+		return "", ErrPreconditionFailed
+	}
+	_, err = sqlitePut(ctx, tx, name, content, author)
+	if err != nil {
+		return "", err
+	}
+	err = sqliteRecordAudit(ctx, tx, AuditActionPut, name, current, content)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return quoteETag(contentHash(content)), nil
+}
+
+func (store *SQLiteStore) Patch(ctx context.Context, name string, patch func(content []byte) ([]config.ConfigItem, error), author string, precondition Precondition) (string, error) {
+	defer store.metrics.timeQuery("configPATCH")()
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	var current string
+	err = tracedGet(ctx, tx, &current, "SELECT content FROM documents WHERE name = ? AND deleted_at IS NULL", name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !precondition.allows(quoteETag(contentHash([]byte(current))), true) {
+		return "", ErrPreconditionFailed
+	}
+	data, err := patch([]byte(current))
+	if err != nil {
+		return "", err
+	}
+	content, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	_, err = sqlitePut(ctx, tx, name, content, author)
+	if err != nil {
+		return "", err
+	}
+	err = sqliteRecordAudit(ctx, tx, AuditActionPatch, name, []byte(current), content)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return quoteETag(contentHash(content)), nil
+}
+
+// sqliteContent returns the content of the stored document, which does not
+// exist while it is in the trash. Content is always written in canonical form,
+// so it can be hashed as stored.
+func sqliteContent(ctx context.Context, tx *sqlx.Tx, name string) ([]byte, bool, error) {
+	var content string
+	err := tracedGet(ctx, tx, &content, "SELECT content FROM documents WHERE name = ? AND deleted_at IS NULL", name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return []byte(content), true, nil
+}
+
+func sqlitePut(ctx context.Context, tx *sqlx.Tx, name string, content []byte, author string) (int, error) {
+	now := time.Now().UTC()
+	stmt := `
+                INSERT INTO documents (name, content, created_at)
+                VALUES (?, ?, ?)
+                ON CONFLICT (name)
+                DO UPDATE SET content = excluded.content, deleted_at = NULL;
+        `
+	_, err := tracedExec(ctx, tx, stmt, name, string(content), now)
+	if err != nil {
+		return 0, err
+	}
+	versionStmt := `
+                INSERT INTO document_versions (name, version, content, content_hash, author, created_at)
+                SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ?, ?
+                FROM document_versions
+                WHERE name = ?
+                RETURNING version;
+        `
+	var version int
+	err = tracedGet(ctx, tx, &version, versionStmt, name, string(content), contentHash(content), author, now, name)
+	if err != nil {
+		return 0, err
+	}
+	stampStmt := "UPDATE documents SET version = ?, updated_at = ?, updated_by = ? WHERE name = ?"
+	_, err = tracedExec(ctx, tx, stampStmt, version, now, author, name)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Delete moves the document to the trash. Transactions hold the write lock
+// from the start, so of two concurrent deletes only the first finds it.
+func (store *SQLiteStore) Delete(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configDELETE")()
+	stmt := `
+                UPDATE documents SET deleted_at = ?
+                WHERE name = ? AND deleted_at IS NULL
+                RETURNING ` + documentColumns + `;
+        `
+	return store.remove(ctx, AuditActionDelete, precondition, stmt, time.Now().UTC(), name)
+}
+
+// remove runs stmt, an UPDATE or DELETE of one document that returns its row,
+// and commits it, recorded as action, if the precondition holds for the
+// content that was removed.
+func (store *SQLiteStore) remove(ctx context.Context, action string, precondition Precondition, stmt string, args ...any) (*StoredConfig, error) {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	doc := sqliteDocument{}
+	err = tracedGet(ctx, tx, &doc, stmt, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	stored, err := doc.stored()
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(stored.ETag, true) {
+		return nil, ErrPreconditionFailed
+	}
+	err = sqliteRecordAudit(ctx, tx, action, doc.Name, []byte(doc.Content), nil)
+	if err != nil {
+		return nil, err
+	}
+	if action == AuditActionPurge {
+		err = sqliteDeleteVersions(ctx, tx, doc.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// sqliteDeleteVersions deletes the history of a purged document.
+func sqliteDeleteVersions(ctx context.Context, tx *sqlx.Tx, name string) error {
+	_, err := tracedExec(ctx, tx, "DELETE FROM document_versions WHERE name = ?", name)
+	return err
+}
+
+func (store *SQLiteStore) Trash(ctx context.Context) ([]TrashedConfig, error) {
+	defer store.metrics.timeQuery("configTRASH")()
+	stmt := `
+                SELECT name, deleted_at
+                FROM documents
+                WHERE deleted_at IS NOT NULL
+                ORDER BY deleted_at DESC, name;
+        `
+	rows := []struct {
+		Name      string     `db:"name"`
+		DeletedAt sqliteTime `db:"deleted_at"`
+	}{}
+	err := tracedSelect(ctx, store.db, &rows, stmt)
+	if err != nil {
+		return nil, err
+	}
+	trashed := make([]TrashedConfig, len(rows))
+	for i, row := range rows {
+		trashed[i] = TrashedConfig{Name: row.Name, DeletedAt: row.DeletedAt.Time}
+	}
+	return trashed, nil
+}
+
+func (store *SQLiteStore) Restore(ctx context.Context, name string) (bool, error) {
+	defer store.metrics.timeQuery("configRESTORE")()
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var content string
+	stmt := "UPDATE documents SET deleted_at = NULL WHERE name = ? AND deleted_at IS NOT NULL RETURNING content"
+	err = tracedGet(ctx, tx, &content, stmt, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	err = sqliteRecordAudit(ctx, tx, AuditActionRestore, name, nil, []byte(content))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (store *SQLiteStore) Purge(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configPURGE")()
+	stmt := "DELETE FROM documents WHERE name = ? RETURNING " + documentColumns
+	return store.remove(ctx, AuditActionPurge, precondition, stmt, name)
+}
+
+func (store *SQLiteStore) PurgeTrash(ctx context.Context, before time.Time) ([]string, error) {
+	defer store.metrics.timeQuery("configPURGETRASH")()
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	purged := []struct {
+		Name    string `db:"name"`
+		Content string `db:"content"`
+	}{}
+	err = tracedSelect(ctx, tx, &purged, "DELETE FROM documents WHERE deleted_at < ? RETURNING name, content", before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(purged, func(i, j int) bool { return purged[i].Name < purged[j].Name })
+	names := make([]string, len(purged))
+	for i, doc := range purged {
+		err = sqliteRecordAudit(ctx, tx, AuditActionPurge, doc.Name, []byte(doc.Content), nil)
+		if err != nil {
+			return nil, err
+		}
+		err = sqliteDeleteVersions(ctx, tx, doc.Name)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = doc.Name
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (store *SQLiteStore) List(ctx context.Context, query ConfigListQuery) ([]ConfigSummary, error) {
+	defer store.metrics.timeQuery("configLIST")()
+	// SQLite's LIKE ignores case, so match the prefix with substr to behave
+	// like Postgres.
+	stmt := `
+                SELECT
+                    d.name,
+                    length(CAST(d.content AS BLOB)) AS size,
+                    json_array_length(d.content) AS tabs,
+                    COALESCE((
+                        SELECT json_group_array(DISTINCT json_extract(item.value, '$.guppyConfig.dataType'))
+                        FROM json_each(d.content) AS item
+                        WHERE json_extract(item.value, '$.guppyConfig.dataType') IS NOT NULL
+                    ), '[]') AS data_types,
+                    d.updated_at
+                FROM documents AS d
+                WHERE d.deleted_at IS NULL
+                    AND d.name > ?
+                    AND substr(d.name, 1, length(?)) = ?
+                    AND (? = '' OR EXISTS (
+                        SELECT 1
+                        FROM json_each(d.content) AS item
+                        WHERE json_extract(item.value, '$.guppyConfig.dataType') = ?
+                    ))
+                ORDER BY d.name
+                LIMIT ?;
+        `
+	rows := []struct {
+		Name      string     `db:"name"`
+		Size      int        `db:"size"`
+		Tabs      int        `db:"tabs"`
+		DataTypes stringList `db:"data_types"`
+		UpdatedAt sqliteTime `db:"updated_at"`
+	}{}
+	err := tracedSelect(ctx, store.db, &rows, stmt,
+		query.After, query.Prefix, query.Prefix, query.DataType, query.DataType, query.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]ConfigSummary, len(rows))
+	for i, row := range rows {
+		sort.Strings(row.DataTypes)
+		summaries[i] = ConfigSummary{
+			Name:      row.Name,
+			Size:      row.Size,
+			Tabs:      row.Tabs,
+			DataTypes: row.DataTypes,
+		}
+		if row.UpdatedAt.Valid {
+			summaries[i].UpdatedAt = &row.UpdatedAt.Time
+		}
+	}
+	return summaries, nil
+}
+
+func (store *SQLiteStore) Versions(ctx context.Context, name string) ([]DocumentVersion, error) {
+	defer store.metrics.timeQuery("configVersionsGET")()
+	stmt := `
+                SELECT name, version, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = ?
+                ORDER BY version DESC;
+        `
+	versions := []DocumentVersion{}
+	err := tracedSelect(ctx, store.db, &versions, stmt, name)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (store *SQLiteStore) Version(ctx context.Context, name string, version int) (*DocumentVersion, error) {
+	defer store.metrics.timeQuery("configVersionGET")()
+	stmt := `
+                SELECT name, version, CAST(content AS BLOB) AS content, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = ? AND version = ?;
+        `
+	doc := &DocumentVersion{}
+	err := tracedGet(ctx, store.db, doc, stmt, name, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (store *SQLiteStore) Rollback(ctx context.Context, name string, version int, author string, precondition Precondition) (*DocumentVersion, error) {
+	defer store.metrics.timeQuery("configROLLBACK")()
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var content string
+	stmt := "SELECT content FROM document_versions WHERE name = ? AND version = ?"
+	err = tracedGet(ctx, tx, &content, stmt, name, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	current, exists, err := sqliteContent(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !precondition.allows(quoteETag(contentHash(current)), exists) {
+		return nil, ErrPreconditionFailed
+	}
+	newVersion, err := sqlitePut(ctx, tx, name, []byte(content), author)
+	if err != nil {
+		return nil, err
+	}
+	err = sqliteRecordAudit(ctx, tx, AuditActionRollback, name, current, []byte(content))
+	if err != nil {
+		return nil, err
+	}
+	doc := &DocumentVersion{}
+	stmt = `
+                SELECT name, version, content_hash, author, created_at
+                FROM document_versions
+                WHERE name = ? AND version = ?;
+        `
+	err = tracedGet(ctx, tx, doc, stmt, name, newVersion)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// sqliteRecordAudit records the change of name from before to after, made in
+// tx; see newAuditEvent.
+func sqliteRecordAudit(ctx context.Context, tx *sqlx.Tx, action string, name string, before []byte, after []byte) error {
+	event, err := newAuditEvent(ctx, action, name, before, after)
+	if err != nil {
+		return err
+	}
+	stmt := `
+                INSERT INTO audit_events (created_at, action, config_id, actor, source_ip, request_id, before_hash, after_hash, diff)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `
+	_, err = tracedExec(ctx, tx, stmt,
+		event.Time, event.Action, event.ConfigID, event.Actor, event.SourceIP, event.RequestID,
+		event.BeforeHash, event.AfterHash, string(event.Diff),
+	)
+	return err
+}
+
+func (store *SQLiteStore) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	defer store.metrics.timeQuery("auditEventsGET")()
+	stmt := `
+                SELECT id, created_at, action, config_id, actor, source_ip, request_id, before_hash, after_hash,
+                    CAST(diff AS BLOB) AS diff
+                FROM audit_events
+                WHERE id > ?
+                    AND (? = '' OR config_id = ?)
+                    AND (? = '' OR actor = ?)
+                    AND created_at >= ?
+                ORDER BY id
+                LIMIT ?;
+        `
+	events := []AuditEvent{}
+	err := tracedSelect(ctx, store.db, &events, stmt,
+		query.After, query.ConfigID, query.ConfigID, query.Actor, query.Actor, query.Since.UTC(), query.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (store *SQLiteStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
+// sqliteTime scans a timestamp that SQLite returns as text because the
+// column type of an expression is unknown to it.
+type sqliteTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+func (t *sqliteTime) Scan(src any) error {
+	var text string
+	switch value := src.(type) {
+	case nil:
+		t.Valid = false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = value, true
+		return nil
+	case string:
+		text = value
+	case []byte:
+		text = string(value)
+	default:
+		return fmt.Errorf("cannot scan %T into sqliteTime", src)
+	}
+	for _, layout := range sqliteTimeLayouts {
+		parsed, err := time.Parse(layout, text)
+		if err == nil {
+			t.Time, t.Valid = parsed, true
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse %q as a time", text)
+}
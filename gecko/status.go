@@ -0,0 +1,153 @@
+package gecko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// readinessCheckTimeout bounds each of the readiness checks, so a database
+// that hangs fails the probe instead of holding it open.
+const readinessCheckTimeout = 2 * time.Second
+
+// The statuses reported by the probes.
+const (
+	statusOK       = "ok"
+	statusFail     = "fail"
+	statusDraining = "draining"
+)
+
+// statusCheck is the outcome of one readiness check.
+type statusCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type statusResponse struct {
+	Status string        `json:"status"`
+	Checks []statusCheck `json:"checks,omitempty"`
+}
+
+// Drain makes the readiness probe fail from now on, so that load balancers
+// stop sending new requests. Call it before shutting the HTTP server down,
+// and give the probe time to be noticed.
+func (server *Server) Drain() {
+	server.draining.Store(true)
+}
+
+// handleLiveGET answers whether the process is up and serving HTTP. It checks
+// nothing else, so a database outage does not get gecko restarted.
+func (server *Server) handleLiveGET(ctx iris.Context) {
+	_ = jsonResponseFrom(statusResponse{Status: statusOK}, http.StatusOK).write(ctx)
+}
+
+// handleReadyGET answers whether gecko can serve requests: the database is
+// reachable and migrated to the schema this build expects, and the keys to
+// validate tokens with are available. It fails with 503 as soon as the server
+// starts draining.
+func (server *Server) handleReadyGET(ctx iris.Context) {
+	if server.draining.Load() {
+		_ = jsonResponseFrom(statusResponse{Status: statusDraining}, http.StatusServiceUnavailable).write(ctx)
+		return
+	}
+	type readinessCheck struct {
+		name  string
+		check func(context.Context) error
+	}
+	checks := []readinessCheck{{"database", server.store.Ping}}
+	if server.db != nil {
+		checks = append(checks, readinessCheck{"schema", server.checkSchema})
+	}
+	if _, ok := server.jwtApp.(*authutils.JWTApplication); ok {
+		checks = append(checks, readinessCheck{"jwks", server.checkJWKS})
+	}
+
+	response := statusResponse{Status: statusOK}
+	code := http.StatusOK
+	for _, readiness := range checks {
+		check := runStatusCheck(ctx.Request().Context(), readiness.name, readiness.check)
+		if check.Status != statusOK {
+			server.requestLogger(ctx).Warning("readiness check %s failed: %s", check.Name, check.Error)
+			response.Status = statusFail
+			code = http.StatusServiceUnavailable
+		}
+		response.Checks = append(response.Checks, check)
+	}
+	_ = jsonResponseFrom(response, code).write(ctx)
+}
+
+// runStatusCheck times check, giving it at most readinessCheckTimeout.
+func runStatusCheck(ctx context.Context, name string, check func(context.Context) error) statusCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(ctx)
+	result := statusCheck{
+		Name:      name,
+		Status:    statusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = statusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkSchema fails unless the database is at the schema version this build
+// of gecko was written for.
+func (server *Server) checkSchema(ctx context.Context) error {
+	current, err := SchemaVersionContext(ctx, server.db)
+	if err != nil {
+		return err
+	}
+	latest, err := LatestSchemaVersion(dialectOf(server.db))
+	if err != nil {
+		return err
+	}
+	if current != latest {
+		return fmt.Errorf("schema version is %d, gecko expects %d", current, latest)
+	}
+	return nil
+}
+
+// checkJWKS fails unless the JWT app has a key to validate tokens with. When
+// it has none yet, it fetches the key set, which also spares the first
+// request the fetch. One fetch runs at a time, and a fetch that outlasts ctx
+// carries on in the background.
+func (server *Server) checkJWKS(ctx context.Context) error {
+	keys := server.jwtApp.(*authutils.JWTApplication).Keys
+	if !server.jwksFetch.TryLock() {
+		return fmt.Errorf("still fetching keys from %s", keys.URL)
+	}
+	if keys.DefaultKey() != nil {
+		server.jwksFetch.Unlock()
+		return nil
+	}
+	if keys.URL == "" {
+		server.jwksFetch.Unlock()
+		return errors.New("no JWKS endpoint configured")
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer server.jwksFetch.Unlock()
+		err := keys.Refresh()
+		if err == nil && keys.DefaultKey() == nil {
+			err = fmt.Errorf("no keys at %s", keys.URL)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("fetching keys from %s: %w", keys.URL, ctx.Err())
+	}
+}
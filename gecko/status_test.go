@@ -0,0 +1,97 @@
+package gecko
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+func TestStatusProbes(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithDB(db)
+	router := server.MakeRouter()
+
+	get := func(path string) (int, statusResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		response := statusResponse{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return rec.Code, response
+	}
+	checks := func(response statusResponse) map[string]string {
+		statuses := map[string]string{}
+		for _, check := range response.Checks {
+			statuses[check.Name] = check.Status
+			assert.GreaterOrEqual(t, check.LatencyMs, 0.0)
+		}
+		return statuses
+	}
+
+	code, response := get("/_status/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, statusOK, response.Status)
+
+	code, response = get("/_status/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, statusOK, response.Status)
+	assert.Equal(t, map[string]string{"database": statusOK, "schema": statusOK, "jwks": statusOK}, checks(response))
+
+	// A database behind on migrations is not ready.
+	_, err = MigrateDown(db, 1)
+	assert.NoError(t, err)
+	code, response = get("/_status/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusFail, response.Status)
+	assert.Equal(t, map[string]string{"database": statusOK, "schema": statusFail, "jwks": statusOK}, checks(response))
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+
+	server.Drain()
+	code, response = get("/_status/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusDraining, response.Status)
+	code, _ = get("/_status/live")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestStatusReadyWithoutKeys(t *testing.T) {
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys": []}`))
+	}))
+	t.Cleanup(jwksServer.Close)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwksServer.URL)).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithStore(NewMemoryStore())
+	router := server.MakeRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/_status/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	response := statusResponse{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Checks, 2) {
+		assert.Equal(t, statusOK, response.Checks[0].Status)
+		assert.Equal(t, "jwks", response.Checks[1].Name)
+		assert.Equal(t, statusFail, response.Checks[1].Status)
+		assert.Contains(t, response.Checks[1].Error, "no keys")
+	}
+}
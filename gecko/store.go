@@ -0,0 +1,169 @@
+package gecko
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/jmoiron/sqlx"
+)
+
+// StoredConfig is a config document as returned by a ConfigStore.
+type StoredConfig struct {
+	ID      int                 `json:"id"`
+	Name    string              `json:"Name"`
+	Content []config.ConfigItem `json:"content"`
+	// Version is the number of the version Content was written as.
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	UpdatedBy string    `json:"updatedBy"`
+	// ETag is the strong entity tag of Content; see configETag.
+	ETag string `json:"-"`
+}
+
+// TrashedConfig is a config in the trash.
+type TrashedConfig struct {
+	Name      string    `db:"name" json:"name"`
+	DeletedAt time.Time `db:"deleted_at" json:"deletedAt"`
+}
+
+// ConfigStore persists explorer configs along with their version history.
+//
+// Lookups of something that does not exist return a nil result and a nil
+// error. Writes that fail their Precondition return ErrPreconditionFailed.
+// Every change is recorded as an AuditEvent along with it, with the actor and
+// request ID found in ctx.
+type ConfigStore interface {
+	Get(ctx context.Context, name string) (*StoredConfig, error)
+	// Put stores data under name and returns the ETag of the stored content.
+	Put(ctx context.Context, name string, data []config.ConfigItem, author string, precondition Precondition) (string, error)
+	// Patch replaces the content of name with what patch makes of it, all in
+	// one transaction. patch gets the current content in canonical form; its
+	// error is returned as is. Patch returns the ETag of the new content, or ""
+	// if name does not exist.
+	Patch(ctx context.Context, name string, patch func(content []byte) ([]config.ConfigItem, error), author string, precondition Precondition) (string, error)
+	// Delete moves name to the trash and returns the config as it was, or nil
+	// if there was nothing to remove. A config in the trash is treated as
+	// missing everywhere else, and writing it again brings it back.
+	Delete(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error)
+	// Trash lists the configs in the trash, most recently deleted first.
+	Trash(ctx context.Context) ([]TrashedConfig, error)
+	// Restore takes name out of the trash, returning false if it is not there.
+	Restore(ctx context.Context, name string) (bool, error)
+	// Purge deletes name and its versions for good, whether it is in the
+	// trash or not, and returns the config as it was, or nil if there was
+	// nothing to remove. Only the audit log keeps the content.
+	Purge(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error)
+	// PurgeTrash deletes the configs moved to the trash before the given time
+	// for good, along with their versions, and returns their names.
+	PurgeTrash(ctx context.Context, before time.Time) ([]string, error)
+	List(ctx context.Context, query ConfigListQuery) ([]ConfigSummary, error)
+	// Versions lists the history of name, newest first, without content.
+	Versions(ctx context.Context, name string) ([]DocumentVersion, error)
+	Version(ctx context.Context, name string, version int) (*DocumentVersion, error)
+	// Rollback stores the content of an earlier version as a new version.
+	Rollback(ctx context.Context, name string, version int, author string, precondition Precondition) (*DocumentVersion, error)
+	// AuditEvents lists the audit events selected by query, oldest first.
+	AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error)
+	Ping(ctx context.Context) error
+}
+
+// OpenDB connects to the database named by dbUrl: `sqlite:///path/gecko.db`
+// for SQLite, anything else is handed to the Postgres driver.
+func OpenDB(dbUrl string) (*sqlx.DB, error) {
+	if path, found := strings.CutPrefix(dbUrl, "sqlite://"); found {
+		return OpenSQLite(path)
+	}
+	return sqlx.Open(DialectPostgres, dbUrl)
+}
+
+// NewStore returns the ConfigStore for the dialect of db.
+func NewStore(db *sqlx.DB) ConfigStore {
+	if dialectOf(db) == DialectSQLite {
+		return NewSQLiteStore(db)
+	}
+	return NewPostgresStore(db)
+}
+
+// PostgresStore is the ConfigStore backed by the JSONB tables created by the
+// embedded migrations.
+type PostgresStore struct {
+	db *sqlx.DB
+	// metrics, if set, times each database function.
+	metrics *Metrics
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (store *PostgresStore) Get(ctx context.Context, name string) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configGET")()
+	return configGET(ctx, store.db, name)
+}
+
+func (store *PostgresStore) Put(ctx context.Context, name string, data []config.ConfigItem, author string, precondition Precondition) (string, error) {
+	defer store.metrics.timeQuery("configPUT")()
+	return configPUT(ctx, store.db, name, data, author, precondition)
+}
+
+func (store *PostgresStore) Patch(ctx context.Context, name string, patch func(content []byte) ([]config.ConfigItem, error), author string, precondition Precondition) (string, error) {
+	defer store.metrics.timeQuery("configPATCH")()
+	return configPATCH(ctx, store.db, name, patch, author, precondition)
+}
+
+func (store *PostgresStore) Delete(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configDELETE")()
+	return configDELETE(ctx, store.db, name, precondition)
+}
+
+func (store *PostgresStore) Trash(ctx context.Context) ([]TrashedConfig, error) {
+	defer store.metrics.timeQuery("configTRASH")()
+	return configTRASH(ctx, store.db)
+}
+
+func (store *PostgresStore) Restore(ctx context.Context, name string) (bool, error) {
+	defer store.metrics.timeQuery("configRESTORE")()
+	return configRESTORE(ctx, store.db, name)
+}
+
+func (store *PostgresStore) Purge(ctx context.Context, name string, precondition Precondition) (*StoredConfig, error) {
+	defer store.metrics.timeQuery("configPURGE")()
+	return configPURGE(ctx, store.db, name, precondition)
+}
+
+func (store *PostgresStore) PurgeTrash(ctx context.Context, before time.Time) ([]string, error) {
+	defer store.metrics.timeQuery("configPURGETRASH")()
+	return configPURGETRASH(ctx, store.db, before)
+}
+
+func (store *PostgresStore) List(ctx context.Context, query ConfigListQuery) ([]ConfigSummary, error) {
+	defer store.metrics.timeQuery("configLIST")()
+	return configLIST(ctx, store.db, query)
+}
+
+func (store *PostgresStore) Versions(ctx context.Context, name string) ([]DocumentVersion, error) {
+	defer store.metrics.timeQuery("configVersionsGET")()
+	return configVersionsGET(ctx, store.db, name)
+}
+
+func (store *PostgresStore) Version(ctx context.Context, name string, version int) (*DocumentVersion, error) {
+	defer store.metrics.timeQuery("configVersionGET")()
+	return configVersionGET(ctx, store.db, name, version)
+}
+
+func (store *PostgresStore) Rollback(ctx context.Context, name string, version int, author string, precondition Precondition) (*DocumentVersion, error) {
+	defer store.metrics.timeQuery("configROLLBACK")()
+	return configROLLBACK(ctx, store.db, name, version, author, precondition)
+}
+
+func (store *PostgresStore) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	defer store.metrics.timeQuery("auditEventsGET")()
+	return auditEventsGET(ctx, store.db, query)
+}
+
+func (store *PostgresStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
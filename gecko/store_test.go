@@ -0,0 +1,405 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko/config"
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStores returns every ConfigStore that can run here, each freshly
+// migrated. Postgres is included when $GECKO_TEST_DB is set.
+func testStores(t *testing.T) map[string]ConfigStore {
+	stores := map[string]ConfigStore{"memory": NewMemoryStore()}
+
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+	stores["sqlite"] = NewStore(db)
+
+	if dbUrl := os.Getenv("GECKO_TEST_DB"); dbUrl != "" {
+		db, err := OpenDB(dbUrl)
+		assert.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		_, err = MigrateUp(db)
+		assert.NoError(t, err)
+		stores["postgres"] = NewStore(db)
+	}
+	return stores
+}
+
+func testConfig(t *testing.T) []config.ConfigItem {
+	var content []config.ConfigItem
+	assert.NoError(t, json.Unmarshal([]byte(fixtures.TestConfig), &content))
+	return content
+}
+
+func TestConfigStores(t *testing.T) {
+	for backend, store := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			name := "store-" + t.Name()
+			assert.NoError(t, store.Ping(ctx))
+
+			missing, err := store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Nil(t, missing)
+			deleted, err := store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			assert.Nil(t, deleted)
+
+			content := testConfig(t)
+			etag, err := store.Put(ctx, name, content, "alice", Precondition{IfNoneMatch: "*"})
+			assert.NoError(t, err)
+			_, err = store.Put(ctx, name, content, "alice", Precondition{IfNoneMatch: "*"})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+
+			stored, err := store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Equal(t, name, stored.Name)
+			assert.Equal(t, content[0].TabTitle, stored.Content[0].TabTitle)
+			assert.Equal(t, etag, stored.ETag)
+			assert.NotZero(t, stored.ID)
+			assert.Equal(t, 1, stored.Version)
+			assert.Equal(t, "alice", stored.UpdatedBy)
+			assert.WithinDuration(t, time.Now(), stored.CreatedAt, time.Minute)
+			assert.Equal(t, stored.CreatedAt, stored.UpdatedAt)
+			created := stored
+
+			// upsert
+			content[0].TabTitle = "changed"
+			_, err = store.Put(ctx, name, content, "bob", Precondition{IfMatch: `"stale"`})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+			newETag, err := store.Put(ctx, name, content, "bob", Precondition{IfMatch: etag})
+			assert.NoError(t, err)
+			assert.NotEqual(t, etag, newETag)
+
+			versions, err := store.Versions(ctx, name)
+			assert.NoError(t, err)
+			assert.Len(t, versions, 2)
+			assert.Equal(t, 2, versions[0].Version)
+			assert.Equal(t, "bob", versions[0].Author)
+			assert.Equal(t, newETag, quoteETag(versions[0].ContentHash))
+			assert.Empty(t, versions[0].Content)
+
+			first, err := store.Version(ctx, name, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", first.Author)
+			assert.NotEmpty(t, first.Content)
+			none, err := store.Version(ctx, name, 5)
+			assert.NoError(t, err)
+			assert.Nil(t, none)
+
+			rolledBack, err := store.Rollback(ctx, name, 1, "carol", Precondition{})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, rolledBack.Version)
+			stored, err = store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Equal(t, "test", stored.Content[0].TabTitle)
+			assert.Equal(t, etag, stored.ETag)
+
+			patched, err := store.Patch(ctx, name, func(current []byte) ([]config.ConfigItem, error) {
+				var data []config.ConfigItem
+				assert.NoError(t, json.Unmarshal(current, &data))
+				data[0].TabTitle = "patched"
+				return data, nil
+			}, "dave", Precondition{IfMatch: etag})
+			assert.NoError(t, err)
+			stored, err = store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Equal(t, "patched", stored.Content[0].TabTitle)
+			assert.Equal(t, patched, stored.ETag)
+			assert.Equal(t, created.ID, stored.ID)
+			assert.Equal(t, 4, stored.Version)
+			assert.Equal(t, "dave", stored.UpdatedBy)
+			assert.True(t, created.CreatedAt.Equal(stored.CreatedAt))
+			assert.False(t, stored.UpdatedAt.Before(created.UpdatedAt))
+			_, err = store.Patch(ctx, name, func([]byte) ([]config.ConfigItem, error) {
+				return nil, ErrPatchConflict
+			}, "dave", Precondition{})
+			assert.ErrorIs(t, err, ErrPatchConflict)
+			missingETag, err := store.Patch(ctx, name+"-missing", func([]byte) ([]config.ConfigItem, error) {
+				t.Error("patch called for a missing config")
+				return nil, nil
+			}, "dave", Precondition{})
+			assert.NoError(t, err)
+			assert.Empty(t, missingETag)
+			versions, err = store.Versions(ctx, name)
+			assert.NoError(t, err)
+			assert.Len(t, versions, 4)
+			etag = patched
+
+			summaries, err := store.List(ctx, ConfigListQuery{Prefix: name, DataType: "file", Limit: 10})
+			assert.NoError(t, err)
+			assert.Len(t, summaries, 1)
+			assert.Equal(t, 1, summaries[0].Tabs)
+			assert.Equal(t, stringList{"file"}, summaries[0].DataTypes)
+			assert.NotNil(t, summaries[0].UpdatedAt)
+			summaries, err = store.List(ctx, ConfigListQuery{Prefix: name, DataType: "patient", Limit: 10})
+			assert.NoError(t, err)
+			assert.Empty(t, summaries)
+
+			_, err = store.Delete(ctx, name, Precondition{IfMatch: `"stale"`})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+			deleted, err = store.Delete(ctx, name, Precondition{IfMatch: etag})
+			assert.NoError(t, err)
+			if assert.NotNil(t, deleted) {
+				assert.Equal(t, name, deleted.Name)
+				assert.Equal(t, 4, deleted.Version)
+				assert.Equal(t, "patched", deleted.Content[0].TabTitle)
+				assert.Equal(t, etag, deleted.ETag)
+			}
+			missing, err = store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Nil(t, missing)
+
+			// Deleted configs go to the trash.
+			deleted, err = store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			assert.Nil(t, deleted)
+			summaries, err = store.List(ctx, ConfigListQuery{Prefix: name, Limit: 10})
+			assert.NoError(t, err)
+			assert.Empty(t, summaries)
+			trashed, err := store.Trash(ctx)
+			assert.NoError(t, err)
+			assert.Len(t, trashed, 1)
+			assert.Equal(t, name, trashed[0].Name)
+			assert.WithinDuration(t, time.Now(), trashed[0].DeletedAt, time.Minute)
+			restored, err := store.Restore(ctx, name)
+			assert.NoError(t, err)
+			assert.True(t, restored)
+			restored, err = store.Restore(ctx, name)
+			assert.NoError(t, err)
+			assert.False(t, restored)
+			stored, err = store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Equal(t, etag, stored.ETag)
+
+			// Writing a config in the trash brings it back.
+			_, err = store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			_, err = store.Put(ctx, name, content, "erin", Precondition{IfNoneMatch: "*"})
+			assert.NoError(t, err)
+			trashed, err = store.Trash(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, trashed)
+
+			_, err = store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			purged, err := store.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Empty(t, purged)
+			purged, err = store.PurgeTrash(ctx, time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{name}, purged)
+			restored, err = store.Restore(ctx, name)
+			assert.NoError(t, err)
+			assert.False(t, restored)
+			// and the history goes with it.
+			versions, err = store.Versions(ctx, name)
+			assert.NoError(t, err)
+			assert.Empty(t, versions)
+
+			// Purge skips the trash.
+			etag, err = store.Put(ctx, name, content, "erin", Precondition{})
+			assert.NoError(t, err)
+			_, err = store.Purge(ctx, name, Precondition{IfMatch: `"stale"`})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+			deleted, err = store.Purge(ctx, name, Precondition{IfMatch: etag})
+			assert.NoError(t, err)
+			if assert.NotNil(t, deleted) {
+				assert.Equal(t, etag, deleted.ETag)
+				assert.Equal(t, "erin", deleted.UpdatedBy)
+			}
+			deleted, err = store.Purge(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			assert.Nil(t, deleted)
+			versions, err = store.Versions(ctx, name)
+			assert.NoError(t, err)
+			assert.Empty(t, versions)
+			version, err := store.Version(ctx, name, 1)
+			assert.NoError(t, err)
+			assert.Nil(t, version)
+			trashed, err = store.Trash(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, trashed)
+		})
+	}
+}
+
+func TestConfigVersions(t *testing.T) {
+	for backend, store := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			name := "versions-" + backend
+
+			versions, err := store.Versions(ctx, name)
+			assert.NoError(t, err)
+			assert.Empty(t, versions)
+			rolledBack, err := store.Rollback(ctx, name, 1, "alice", Precondition{})
+			assert.NoError(t, err)
+			assert.Nil(t, rolledBack)
+
+			// Every write adds a version, numbered from 1.
+			content := testConfig(t)
+			firstETag, err := store.Put(ctx, name, content, "alice", Precondition{})
+			assert.NoError(t, err)
+			content[0].TabTitle = "second"
+			secondETag, err := store.Put(ctx, name, content, "bob", Precondition{})
+			assert.NoError(t, err)
+			versions, err = store.Versions(ctx, name)
+			assert.NoError(t, err)
+			if assert.Len(t, versions, 2) {
+				assert.Equal(t, 2, versions[0].Version)
+				assert.Equal(t, "bob", versions[0].Author)
+				assert.Equal(t, secondETag, quoteETag(versions[0].ContentHash))
+				assert.Equal(t, 1, versions[1].Version)
+				assert.Equal(t, "alice", versions[1].Author)
+				assert.Equal(t, firstETag, quoteETag(versions[1].ContentHash))
+			}
+
+			first, err := store.Version(ctx, name, 1)
+			assert.NoError(t, err)
+			if assert.NotNil(t, first) {
+				assert.Equal(t, name, first.Name)
+				assert.Equal(t, 1, first.Version)
+				var data []config.ConfigItem
+				assert.NoError(t, json.Unmarshal(first.Content, &data))
+				assert.Equal(t, "test", data[0].TabTitle)
+			}
+
+			// An unknown version is not found, and cannot be rolled back to.
+			for _, unknown := range []int{0, 3} {
+				version, err := store.Version(ctx, name, unknown)
+				assert.NoError(t, err)
+				assert.Nil(t, version)
+				rolledBack, err = store.Rollback(ctx, name, unknown, "carol", Precondition{})
+				assert.NoError(t, err)
+				assert.Nil(t, rolledBack)
+			}
+
+			// A rollback is a new version with the old content; the versions
+			// after the one rolled back to stay in the history.
+			_, err = store.Rollback(ctx, name, 1, "carol", Precondition{IfMatch: firstETag})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+			rolledBack, err = store.Rollback(ctx, name, 1, "carol", Precondition{IfMatch: secondETag})
+			assert.NoError(t, err)
+			if assert.NotNil(t, rolledBack) {
+				assert.Equal(t, 3, rolledBack.Version)
+				assert.Equal(t, "carol", rolledBack.Author)
+				assert.Equal(t, firstETag, quoteETag(rolledBack.ContentHash))
+			}
+			stored, err := store.Get(ctx, name)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, stored.Version)
+			assert.Equal(t, "test", stored.Content[0].TabTitle)
+			assert.Equal(t, firstETag, stored.ETag)
+			versions, err = store.Versions(ctx, name)
+			assert.NoError(t, err)
+			if assert.Len(t, versions, 3) {
+				assert.Equal(t, []int{3, 2, 1}, []int{versions[0].Version, versions[1].Version, versions[2].Version})
+			}
+		})
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	for backend, store := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			ctx := withAuditActor(context.Background(), auditActor{name: "alice", sourceIP: "198.51.100.4"})
+			name := "audit-" + backend
+			content := testConfig(t)
+			etag, err := store.Put(ctx, name, content, "alice", Precondition{})
+			assert.NoError(t, err)
+			content[0].GuppyConfig.NodeCountTitle = "Files"
+			changed, err := store.Put(ctx, name, content, "alice", Precondition{})
+			assert.NoError(t, err)
+			_, err = store.Rollback(ctx, name, 1, "alice", Precondition{})
+			assert.NoError(t, err)
+			_, err = store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			_, err = store.Restore(ctx, name)
+			assert.NoError(t, err)
+			_, err = store.Delete(ctx, name, Precondition{})
+			assert.NoError(t, err)
+			// A change that fails its precondition is not recorded.
+			_, err = store.Purge(ctx, name, Precondition{IfMatch: `"stale"`})
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+			_, err = store.PurgeTrash(withAuditActor(context.Background(), auditActor{name: "gecko"}), time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+
+			events, err := store.AuditEvents(ctx, AuditQuery{ConfigID: name, Limit: 10})
+			assert.NoError(t, err)
+			actions := []string{}
+			for _, event := range events {
+				actions = append(actions, event.Action)
+			}
+			assert.Equal(t, []string{
+				AuditActionPut, AuditActionPut, AuditActionRollback, AuditActionDelete,
+				AuditActionRestore, AuditActionDelete, AuditActionPurge,
+			}, actions)
+			if len(events) != 7 {
+				return
+			}
+			created := events[0]
+			assert.NotZero(t, created.ID)
+			assert.Equal(t, name, created.ConfigID)
+			assert.Equal(t, "alice", created.Actor)
+			assert.Equal(t, "198.51.100.4", created.SourceIP)
+			assert.WithinDuration(t, time.Now(), created.Time, time.Minute)
+			assert.Empty(t, created.BeforeHash)
+			assert.Equal(t, etag, quoteETag(created.AfterHash))
+			assert.Equal(t, etag, quoteETag(events[1].BeforeHash))
+			assert.Equal(t, changed, quoteETag(events[1].AfterHash))
+			assert.JSONEq(t, `[{"op":"replace","path":"/0/guppyConfig/nodeCountTitle","value":"Files"}]`, string(events[1].Diff))
+			assert.Equal(t, etag, quoteETag(events[2].AfterHash))
+			assert.Equal(t, etag, quoteETag(events[3].BeforeHash))
+			assert.Empty(t, events[3].AfterHash)
+			assert.JSONEq(t, `[{"op":"remove","path":"/0"}]`, string(events[3].Diff))
+			assert.Empty(t, events[4].BeforeHash)
+			assert.Equal(t, etag, quoteETag(events[4].AfterHash))
+			assert.Equal(t, "gecko", events[6].Actor)
+			for i := 1; i < len(events); i++ {
+				assert.Greater(t, events[i].ID, events[i-1].ID)
+			}
+
+			page, err := store.AuditEvents(ctx, AuditQuery{ConfigID: name, After: events[1].ID, Limit: 2})
+			assert.NoError(t, err)
+			assert.Equal(t, events[2:4], page)
+			page, err = store.AuditEvents(ctx, AuditQuery{ConfigID: name, Actor: "gecko", Limit: 10})
+			assert.NoError(t, err)
+			assert.Equal(t, events[6:], page)
+			page, err = store.AuditEvents(ctx, AuditQuery{ConfigID: name, Since: events[3].Time, Limit: 10})
+			assert.NoError(t, err)
+			assert.Contains(t, page, events[3])
+			assert.Contains(t, page, events[6])
+			page, err = store.AuditEvents(ctx, AuditQuery{ConfigID: name, Since: time.Now().Add(time.Hour), Limit: 10})
+			assert.NoError(t, err)
+			assert.Empty(t, page)
+
+			// The database refuses to change audit events.
+			var db *sqlx.DB
+			switch store := store.(type) {
+			case *SQLiteStore:
+				db = store.db
+			case *PostgresStore:
+				db = store.db
+			}
+			if db != nil {
+				_, err = db.Exec(db.Rebind("UPDATE audit_events SET actor = 'mallory' WHERE id = ?"), created.ID)
+				assert.ErrorContains(t, err, "audit events cannot be changed")
+				_, err = db.Exec(db.Rebind("DELETE FROM audit_events WHERE id = ?"), created.ID)
+				assert.ErrorContains(t, err, "audit events cannot be changed")
+			}
+		})
+	}
+}
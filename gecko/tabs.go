@@ -0,0 +1,210 @@
+package gecko
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/kataras/iris/v12"
+)
+
+// ErrTabNotFound means a config has no tab with the requested title.
+var ErrTabNotFound = errors.New("no such tab")
+
+// The handlers in this file work on a single tab, a ConfigItem identified by
+// its tabTitle, so that different owners can maintain different tabs of one
+// config. Writes go through updateConfig: they edit the stored config as JSON,
+// keeping properties gecko does not model, and the result is checked and
+// stored like a PUT of the whole config.
+
+func (server *Server) handleTabGET(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	tabTitle := ctx.Params().Get("tabTitle")
+	doc, err := server.store.Get(ctx.Request().Context(), configId)
+	if err != nil {
+		msg := fmt.Sprintf("config query failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if doc == nil {
+		msg := fmt.Sprintf("no configId found with configId: %s", configId)
+		errResponse := newErrorResponse(msg, 404, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	for _, item := range doc.Content {
+		if item.TabTitle != tabTitle {
+			continue
+		}
+		// The ETag is the one of the whole config, so it can be used in
+		// If-Match when writing the tab back.
+		ctx.Header("ETag", doc.ETag)
+		if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, doc.ETag, true) {
+			ctx.StatusCode(http.StatusNotModified)
+			return
+		}
+		_ = jsonResponseFrom(item, http.StatusOK).write(ctx)
+		return
+	}
+	errResponse := newErrorResponse(fmt.Sprintf("%s: %q", ErrTabNotFound, tabTitle), 404, nil)
+	errResponse.log.write(server.requestLogger(ctx))
+	_ = errResponse.write(ctx)
+}
+
+// handleTabPUT replaces the tab with the title in the path, or appends it if
+// the config has no such tab yet.
+func (server *Server) handleTabPUT(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	tabTitle := ctx.Params().Get("tabTitle")
+	tab, errResponse := readTab(ctx)
+	if errResponse == nil {
+		if title, exists := tab["tabTitle"]; !exists {
+			tab["tabTitle"] = tabTitle
+		} else if title != tabTitle {
+			msg := fmt.Sprintf("tabTitle %v does not match the tab %q in the path", title, tabTitle)
+			errResponse = newErrorResponse(msg, 400, nil)
+		}
+	}
+	if errResponse != nil {
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	created := false
+	etag, ok := server.updateConfig(ctx, configId, func(doc any) (any, error) {
+		tabs, err := configTabs(doc)
+		if err != nil {
+			return nil, err
+		}
+		index := findTab(tabs, tabTitle)
+		if index < 0 {
+			created = true
+			return append(tabs, tab), nil
+		}
+		tabs[index] = tab
+		return tabs, nil
+	})
+	if !ok {
+		return
+	}
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("ACCEPTED: %s tab %s", configId, tabTitle)}
+	status := http.StatusOK
+	if created {
+		okmsg["code"] = http.StatusCreated
+		status = http.StatusCreated
+	}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	ctx.Header("ETag", etag)
+	_ = jsonResponseFrom(okmsg, status).write(ctx)
+}
+
+// handleTabPOST adds a new tab. It goes at the index given by `?position=`,
+// counting from 0, or at the end.
+func (server *Server) handleTabPOST(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	position := ctx.URLParamIntDefault("position", -1)
+	tab, errResponse := readTab(ctx)
+	if errResponse == nil && ctx.URLParamExists("position") && position < 0 {
+		errResponse = newErrorResponse("position must be a number of 0 or more", 400, nil)
+	}
+	tabTitle, _ := tab["tabTitle"].(string)
+	if errResponse == nil && tabTitle == "" {
+		errResponse = newErrorResponse("tabTitle is required", 400, nil)
+	}
+	if errResponse != nil {
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	etag, ok := server.updateConfig(ctx, configId, func(doc any) (any, error) {
+		tabs, err := configTabs(doc)
+		if err != nil {
+			return nil, err
+		}
+		if findTab(tabs, tabTitle) >= 0 {
+			return nil, fmt.Errorf("%w: tab %q already exists", ErrPatchConflict, tabTitle)
+		}
+		if position < 0 {
+			return append(tabs, tab), nil
+		}
+		if position > len(tabs) {
+			return nil, fmt.Errorf("%w: position %d is past the end of %d tabs", ErrPatchConflict, position, len(tabs))
+		}
+		return append(tabs[:position], append([]any{tab}, tabs[position:]...)...), nil
+	})
+	if !ok {
+		return
+	}
+	okmsg := map[string]any{"code": 201, "message": fmt.Sprintf("CREATED: %s tab %s", configId, tabTitle)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	ctx.Header("ETag", etag)
+	ctx.Header("Location", fmt.Sprintf("/config/%s/tabs/%s", url.PathEscape(configId), url.PathEscape(tabTitle)))
+	_ = jsonResponseFrom(okmsg, http.StatusCreated).write(ctx)
+}
+
+func (server *Server) handleTabDELETE(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	tabTitle := ctx.Params().Get("tabTitle")
+	etag, ok := server.updateConfig(ctx, configId, func(doc any) (any, error) {
+		tabs, err := configTabs(doc)
+		if err != nil {
+			return nil, err
+		}
+		index := findTab(tabs, tabTitle)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrTabNotFound, tabTitle)
+		}
+		return append(tabs[:index], tabs[index+1:]...), nil
+	})
+	if !ok {
+		return
+	}
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("DELETED: %s tab %s", configId, tabTitle)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	ctx.Header("ETag", etag)
+	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
+}
+
+// readTab reads a tab, a single JSON object, from the request body.
+func readTab(ctx iris.Context) (map[string]any, *ErrorResponse) {
+	body, err := ctx.GetBody()
+	if err != nil {
+		msg := fmt.Sprintf("GetBody() failed: %s", err.Error())
+		return nil, newErrorResponse(msg, 500, nil)
+	}
+	if len(body) == 0 {
+		return nil, newErrorResponse("empty request body", 400, nil)
+	}
+	value, err := decodeJSON(body)
+	if err != nil {
+		return nil, newErrorResponse("Invalid JSON format", 400, nil)
+	}
+	tab, ok := value.(map[string]any)
+	if !ok {
+		return nil, newErrorResponse("a tab must be a JSON object", 400, nil)
+	}
+	return tab, nil
+}
+
+// configTabs returns the tabs of a stored config decoded as JSON.
+func configTabs(doc any) ([]any, error) {
+	tabs, ok := doc.([]any)
+	if !ok {
+		return nil, fmt.Errorf("stored config is a %T, not an array", doc)
+	}
+	return tabs, nil
+}
+
+// findTab returns the index of the tab with the given title, or -1.
+func findTab(tabs []any, tabTitle string) int {
+	for i, tab := range tabs {
+		if object, ok := tab.(map[string]any); ok && object["tabTitle"] == tabTitle {
+			return i
+		}
+	}
+	return -1
+}
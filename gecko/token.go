@@ -0,0 +1,163 @@
+package gecko
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kataras/iris/v12"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// tokenInfoKey is the iris context value key under which authMiddleware
+// stores the decoded token for the request.
+const tokenInfoKey = "gecko.tokenInfo"
+
+type TokenInfo struct {
+	token    string
+	username string
+	subject  string
+	clientID string
+	policies []string
+	claims   map[string]any
+}
+
+func (server *Server) decodeToken(token string) (*TokenInfo, error) {
+	missingRequiredField := func(field string) error {
+		msg := fmt.Sprintf(
+			"failed to decode token: missing required field `%s`",
+			field,
+		)
+		return errors.New(msg)
+	}
+	fieldTypeError := func(field string) error {
+		msg := fmt.Sprintf(
+			"failed to decode token: field `%s` has wrong type",
+			field,
+		)
+		return errors.New(msg)
+	}
+	claims, err := server.jwtApp.Decode(token)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token: %s", err.Error())
+	}
+	// Decode only checks the signature, so the expiration still needs to be
+	// validated here.
+	expected := &authutils.Expected{}
+	err = expected.Validate(claims)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token: %s", err.Error())
+	}
+
+	info := TokenInfo{token: token, claims: *claims}
+	if subjectInterface, exists := (*claims)["sub"]; exists {
+		subject, casted := subjectInterface.(string)
+		if !casted {
+			return nil, fieldTypeError("sub")
+		}
+		info.subject = subject
+	}
+	if clientIDInterface, exists := (*claims)["azp"]; exists {
+		clientID, casted := clientIDInterface.(string)
+		if !casted {
+			return nil, fieldTypeError("azp")
+		}
+		info.clientID = clientID
+	}
+	contextInterface, exists := (*claims)["context"]
+	if !exists {
+		return &info, nil
+	}
+	context, casted := contextInterface.(map[string]any)
+	if !casted {
+		return nil, fieldTypeError("context")
+	}
+	userInterface, exists := context["user"]
+	// it's ok if there's no user; it's a client credentials token
+	if !exists {
+		return &info, nil
+	}
+	user, casted := userInterface.(map[string]any)
+	if !casted {
+		return nil, fieldTypeError("user")
+	}
+	usernameInterface, exists := user["name"]
+	if !exists {
+		return nil, missingRequiredField("name")
+	}
+	info.username, casted = usernameInterface.(string)
+	if !casted {
+		return nil, fieldTypeError("name")
+	}
+	if policiesInterface, exists := user["policies"]; exists {
+		policiesInterfaceSlice, casted := policiesInterface.([]any)
+		if !casted {
+			return nil, fieldTypeError("policies")
+		}
+		info.policies = make([]string, len(policiesInterfaceSlice))
+		for i, policyInterface := range policiesInterfaceSlice {
+			policyString, casted := policyInterface.(string)
+			if !casted {
+				return nil, fieldTypeError("policies")
+			}
+			info.policies[i] = policyString
+		}
+	}
+	return &info, nil
+}
+
+// authMiddleware requires a valid bearer token on every request it wraps,
+// except GET requests when the server allows anonymous reads. The decoded
+// token is stored on the iris context; see tokenInfoFrom.
+func (server *Server) authMiddleware(ctx iris.Context) {
+	authHeader := ctx.GetHeader("Authorization")
+	if authHeader == "" {
+		if ctx.Method() == http.MethodGet && server.anonymousReads {
+			ctx.Next()
+			return
+		}
+		server.unauthorized(ctx, "missing bearer token in Authorization header")
+		return
+	}
+	userJWT := strings.TrimPrefix(authHeader, "Bearer ")
+	userJWT = strings.TrimPrefix(userJWT, "bearer ")
+	info, err := server.decodeToken(userJWT)
+	if err != nil {
+		server.unauthorized(ctx, err.Error())
+		return
+	}
+	ctx.Values().Set(tokenInfoKey, info)
+	ctx.Next()
+}
+
+func (server *Server) unauthorized(ctx iris.Context, msg string) {
+	errResponse := newErrorResponse(msg, http.StatusUnauthorized, nil)
+	errResponse.log.write(server.requestLogger(ctx))
+	ctx.Header("WWW-Authenticate", "Bearer")
+	_ = errResponse.write(ctx)
+	ctx.StopExecution()
+}
+
+// actor names the caller for the records gecko keeps about changes: the
+// username, falling back to the subject and then the client ID for client
+// credentials tokens. It is empty for anonymous requests.
+func (info *TokenInfo) actor() string {
+	if info == nil {
+		return ""
+	}
+	if info.username != "" {
+		return info.username
+	}
+	if info.subject != "" {
+		return info.subject
+	}
+	return info.clientID
+}
+
+// tokenInfoFrom returns the token decoded by authMiddleware, or nil if the
+// request was served anonymously.
+func tokenInfoFrom(ctx iris.Context) *TokenInfo {
+	info, _ := ctx.Values().Get(tokenInfoKey).(*TokenInfo)
+	return info
+}
@@ -0,0 +1,98 @@
+package gecko
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+func newAuthTestRouter(t *testing.T, anonymousReads bool) (*iris.Application, *fixtures.JWKS) {
+	jwks := fixtures.NewJWKS(t)
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAnonymousReads(anonymousReads)
+	echo := func(ctx iris.Context) {
+		info := tokenInfoFrom(ctx)
+		if info == nil {
+			ctx.WriteString("anonymous")
+			return
+		}
+		ctx.WriteString(info.username)
+	}
+	router := iris.New()
+	router.Get("/config/{configId}", server.authMiddleware, echo)
+	router.Put("/config/{configId}", server.authMiddleware, echo)
+	assert.NoError(t, router.Build())
+	return router, jwks
+}
+
+func doRequest(router http.Handler, method, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/config/123", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddlewareValidToken(t *testing.T) {
+	router, jwks := newAuthTestRouter(t, false)
+	rec := doRequest(router, "PUT", jwks.Token(t, "alice", time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", rec.Body.String())
+}
+
+func TestAuthMiddlewareMissingToken(t *testing.T) {
+	router, _ := newAuthTestRouter(t, false)
+	rec := doRequest(router, "PUT", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	var errData map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errData))
+	expectedErrorResponse := map[string]any{
+		"error": map[string]any{
+			"code":    float64(401),
+			"message": "missing bearer token in Authorization header",
+		},
+	}
+	assert.Equal(t, expectedErrorResponse, errData)
+}
+
+func TestAuthMiddlewareExpiredToken(t *testing.T) {
+	router, jwks := newAuthTestRouter(t, false)
+	rec := doRequest(router, "PUT", jwks.Token(t, "alice", time.Now().Add(-time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthMiddlewareBadSignature(t *testing.T) {
+	router, _ := newAuthTestRouter(t, false)
+	other := fixtures.NewJWKS(t)
+	rec := doRequest(router, "PUT", other.Token(t, "mallory", time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthMiddlewareAnonymousReads(t *testing.T) {
+	router, _ := newAuthTestRouter(t, true)
+	rec := doRequest(router, "GET", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "anonymous", rec.Body.String())
+
+	rec = doRequest(router, "PUT", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	router, _ = newAuthTestRouter(t, false)
+	rec = doRequest(router, "GET", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
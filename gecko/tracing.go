@@ -0,0 +1,153 @@
+package gecko
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kataras/iris/v12"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans gecko creates.
+const tracerName = "github.com/ACED-IDP/gecko/gecko"
+
+// The exporters NewTracerProvider can send spans to.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+// NewTracerProvider returns a provider that batches spans to the named
+// exporter, or nil for TraceExporterNone. The OTLP exporter sends over HTTP
+// and is configured by the standard $OTEL_EXPORTER_OTLP_* variables; the
+// stdout exporter writes one JSON span per line to out.
+func NewTracerProvider(ctx context.Context, exporter string, out io.Writer) (*sdktrace.TracerProvider, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case TraceExporterNone, "":
+		return nil, nil
+	case TraceExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	case TraceExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	serviceResource, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("gecko")),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(serviceResource),
+	), nil
+}
+
+// tracingMiddleware gives each request a server span, continuing the trace
+// of the caller's W3C `traceparent` header if there is one. The span travels
+// in the request context, down to the database queries.
+func (server *Server) tracingMiddleware(ctx iris.Context) {
+	request := ctx.Request()
+	parent := propagation.TraceContext{}.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+	route := routeName(ctx)
+	spanCtx, span := server.tracer.Start(parent, request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(request.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(request.URL.Path),
+		),
+	)
+	defer span.End()
+	ctx.ResetRequest(request.WithContext(spanCtx))
+	ctx.Next()
+	status := ctx.GetStatusCode()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// routeName is the path the current route was registered with, such as
+// `/config/{configId}`.
+func routeName(ctx iris.Context) string {
+	if current := ctx.GetCurrentRoute(); current != nil {
+		return current.Path()
+	}
+	return "unmatched"
+}
+
+// startQuerySpan starts a span for a database query as a child of the span in
+// ctx, from the same provider. Without a span in ctx it records nothing. db is
+// what runs the query, a *sqlx.DB or *sqlx.Tx, and tells SQLite from Postgres.
+func startQuerySpan(ctx context.Context, db any, stmt string) (context.Context, trace.Span) {
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	operation, _, _ := strings.Cut(stmt, " ")
+	system := semconv.DBSystemPostgreSQL
+	if driver, ok := db.(interface{ DriverName() string }); ok && driver.DriverName() == DialectSQLite {
+		system = semconv.DBSystemSqlite
+	}
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, "db "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			system,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(stmt),
+		),
+	)
+}
+
+// endQuerySpan ends a query span. Finding no rows is not an error.
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedGet is sqlx.GetContext in a query span.
+func tracedGet(ctx context.Context, queryer sqlx.QueryerContext, dest any, stmt string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, queryer, stmt)
+	err := sqlx.GetContext(ctx, queryer, dest, stmt, args...)
+	endQuerySpan(span, err)
+	return err
+}
+
+// tracedSelect is sqlx.SelectContext in a query span.
+func tracedSelect(ctx context.Context, queryer sqlx.QueryerContext, dest any, stmt string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, queryer, stmt)
+	err := sqlx.SelectContext(ctx, queryer, dest, stmt, args...)
+	endQuerySpan(span, err)
+	return err
+}
+
+// tracedExec is ExecContext in a query span.
+func tracedExec(ctx context.Context, execer sqlx.ExecerContext, stmt string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, execer, stmt)
+	result, err := execer.ExecContext(ctx, stmt, args...)
+	endQuerySpan(span, err)
+	return result, err
+}
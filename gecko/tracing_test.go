@@ -0,0 +1,107 @@
+package gecko
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	provider, exporter := newTestTracerProvider()
+	server := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithStore(NewMemoryStore()).
+		WithTracerProvider(provider)
+	router := server.MakeRouter()
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+	span := spans[0]
+	assert.Equal(t, "GET /health", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, span.Attributes, attribute.String("http.route", "/health"))
+}
+
+func TestQuerySpans(t *testing.T) {
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	provider, exporter := newTestTracerProvider()
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	var one int
+	assert.NoError(t, tracedGet(ctx, db, &one, "SELECT 1"))
+	assert.Error(t, tracedSelect(ctx, db, &[]int{}, "SELECT * FROM missing"))
+	// Without a span in the context, nothing is recorded.
+	_, err = tracedExec(context.Background(), db, "SELECT 1")
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	for _, span := range spans[:2] {
+		assert.Equal(t, "db SELECT", span.Name)
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+	}
+	assert.Contains(t, spans[0].Attributes, attribute.String("db.query.text", "SELECT 1"))
+	assert.Contains(t, spans[0].Attributes, attribute.String("db.system", "sqlite"))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "parent", spans[2].Name)
+}
+
+func TestSQLiteStoreQuerySpans(t *testing.T) {
+	db, err := OpenDB("sqlite://" + filepath.Join(t.TempDir(), "gecko.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = MigrateUp(db)
+	assert.NoError(t, err)
+	store := NewSQLiteStore(db)
+
+	provider, exporter := newTestTracerProvider()
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, err = store.Put(ctx, "traced", nil, "erin", Precondition{})
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	names := []string{}
+	for _, span := range spans[:len(spans)-1] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		names = append(names, span.Name)
+	}
+	// the current content, the document, its version, the version stamp and
+	// the audit event
+	assert.Equal(t, []string{"db SELECT", "db INSERT", "db INSERT", "db UPDATE", "db INSERT"}, names)
+}
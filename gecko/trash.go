@@ -0,0 +1,103 @@
+package gecko
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// handleTrashGET lists the configs in the trash that the caller may delete,
+// and so restore. Even with anonymous reads, the names of deleted configs are
+// only shown to callers with a token.
+func (server *Server) handleTrashGET(ctx iris.Context) {
+	if tokenInfoFrom(ctx) == nil {
+		server.unauthorized(ctx, "missing bearer token in Authorization header")
+		return
+	}
+	trashed, err := server.store.Trash(ctx.Request().Context())
+	if err != nil {
+		msg := fmt.Sprintf("trash query failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	authorize, err := server.configAuthorizer(ctx, ActionDelete)
+	if err != nil {
+		msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	configs := []TrashedConfig{}
+	for _, config := range trashed {
+		authorized, err := authorize(config.Name)
+		if err != nil {
+			msg := fmt.Sprintf("authorization check failed: %s", err.Error())
+			errResponse := newErrorResponse(msg, http.StatusBadGateway, nil)
+			errResponse.log.write(server.requestLogger(ctx))
+			_ = errResponse.write(ctx)
+			return
+		}
+		if authorized {
+			configs = append(configs, config)
+		}
+	}
+	_ = jsonResponseFrom(map[string]any{"configs": configs}, http.StatusOK).write(ctx)
+}
+
+func (server *Server) handleConfigRestorePOST(ctx iris.Context) {
+	configId := ctx.Params().Get("configId")
+	restored, err := server.store.Restore(ctx.Request().Context(), configId)
+	if err != nil {
+		msg := fmt.Sprintf("config restore failed: %s", err.Error())
+		errResponse := newErrorResponse(msg, 500, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	if !restored {
+		msg := fmt.Sprintf("no configId found in the trash with configId: %s", configId)
+		errResponse := newErrorResponse(msg, 404, nil)
+		errResponse.log.write(server.requestLogger(ctx))
+		_ = errResponse.write(ctx)
+		return
+	}
+	okmsg := map[string]any{"code": 200, "message": fmt.Sprintf("RESTORED: %s", configId)}
+	server.requestLogger(ctx).Info("%s", okmsg["message"])
+	_ = jsonResponseFrom(okmsg, http.StatusOK).write(ctx)
+}
+
+// PurgeTrash deletes the configs that have been in the trash for longer than
+// retention for good.
+func (server *Server) PurgeTrash(ctx context.Context, retention time.Duration) error {
+	ctx = withAuditActor(ctx, auditActor{name: trashPurgeActor})
+	purged, err := server.store.PurgeTrash(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	for _, name := range purged {
+		server.logger.withContext(ctx).Info("purged %s from the trash", name)
+	}
+	return nil
+}
+
+// RunTrashPurger calls PurgeTrash every interval until ctx is done.
+func (server *Server) RunTrashPurger(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := server.PurgeTrash(ctx, retention); err != nil {
+			server.logger.withContext(ctx).Error("purging the trash failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package gecko
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+func TestTrashGET(t *testing.T) {
+	jwks := fixtures.NewJWKS(t)
+	// The stand-in only lets the caller delete ohsu-test.
+	arboristServer := newArboristStandIn(t, "/programs/ohsu/projects/test/configs/ohsu-test", ActionDelete)
+	store := NewMemoryStore()
+	for _, name := range []string{"ohsu-test", "ohsu-other"} {
+		_, err := store.Put(context.Background(), name, testConfig(t), "alice", Precondition{})
+		assert.NoError(t, err)
+		_, err = store.Delete(context.Background(), name, Precondition{})
+		assert.NoError(t, err)
+	}
+	router := NewServer().
+		WithLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(NewArboristAuthorizer(arboristServer.URL)).
+		WithAnonymousReads(true).
+		WithStore(store).
+		MakeRouter()
+
+	// Anonymous reads do not extend to the trash.
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/trash", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest("GET", "/trash", nil)
+	req.Header.Set("Authorization", "Bearer "+jwks.Token(t, "alice", time.Now().Add(time.Hour)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var trash struct {
+		Configs []TrashedConfig `json:"configs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trash))
+	if assert.Len(t, trash.Configs, 1) {
+		assert.Equal(t, "ohsu-test", trash.Configs[0].Name)
+	}
+}
@@ -0,0 +1,68 @@
+// Package version describes the build of gecko. The Dockerfile sets the
+// variables below at link time with `-ldflags "-X ..."`. Without them, a
+// binary built in a git checkout still knows its commit from the VCS
+// information Go stamps into it.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// GitCommit is the full hash of the commit gecko was built from.
+	GitCommit string
+	// GitVersion is the output of `git describe --always --tags`.
+	GitVersion string
+	// BuildTime is when the binary was built, in RFC 3339.
+	BuildTime string
+)
+
+// Info is the build information of the running binary. Fields that are not
+// known are empty.
+type Info struct {
+	GitCommit  string `json:"gitCommit"`
+	GitVersion string `json:"gitVersion"`
+	GoVersion  string `json:"goVersion"`
+	BuildTime  string `json:"buildTime"`
+}
+
+func Get() Info {
+	info := Info{
+		GitCommit:  GitCommit,
+		GitVersion: GitVersion,
+		GoVersion:  runtime.Version(),
+		BuildTime:  BuildTime,
+	}
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	modified := false
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.GitCommit == "" {
+				info.GitCommit = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if info.GitVersion == "" && info.GitCommit != "" && GitCommit == "" {
+		info.GitVersion = shortCommit(info.GitCommit)
+		if modified {
+			info.GitVersion += "-dirty"
+		}
+	}
+	return info
+}
+
+// shortCommit abbreviates a commit hash the way `git describe --always` does
+// when there is no tag.
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
@@ -0,0 +1,20 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	GitCommit, GitVersion, BuildTime = "0123456789abcdef", "v1.2.3", "2024-05-01T00:00:00Z"
+	t.Cleanup(func() { GitCommit, GitVersion, BuildTime = "", "", "" })
+	assert.Equal(t, Info{
+		GitCommit:  "0123456789abcdef",
+		GitVersion: "v1.2.3",
+		GoVersion:  runtime.Version(),
+		BuildTime:  "2024-05-01T00:00:00Z",
+	}, Get())
+	assert.Equal(t, "0123456", shortCommit("0123456789abcdef"))
+}
@@ -1,25 +1,25 @@
 #!/bin/bash
 
+# Creates a local database for development with Homebrew's PostgreSQL. The
+# schema is not created here; run `gecko migrate up` (or start gecko with
+# -auto-migrate) afterwards.
+
+POSTGRES_PASSWORD="${POSTGRES_PASSWORD:-your_strong_password}"
+POSTGRES_DB="${POSTGRES_DB:-testdb}"
+
 # Start PostgreSQL service
 brew services start postgresql
 
 # Wait for PostgreSQL to start (adjust sleep time if needed)
 sleep 5
 
-psql postgres <<EOF
-
-ALTER USER postgres WITH PASSWORD 'your_strong_password';
-
-CREATE DATABASE testdb;
+psql postgres <<SQL
 
-GRANT ALL PRIVILEGES ON DATABASE testdb TO postgres;
+ALTER USER postgres WITH PASSWORD '${POSTGRES_PASSWORD}';
 
-\c testdb;
+CREATE DATABASE ${POSTGRES_DB};
 
-CREATE TABLE IF NOT EXISTS documents (
-    name VARCHAR(255) PRIMARY KEY,
-    content JSONB
-);
+GRANT ALL PRIVILEGES ON DATABASE ${POSTGRES_DB} TO postgres;
 
 \q
-EOF
+SQL
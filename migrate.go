@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ACED-IDP/gecko/gecko"
+	"github.com/ACED-IDP/gecko/gecko/settings"
+)
+
+const migrateUsage = `usage: gecko migrate <up|down|status> [flags]
+       gecko migrate [flags] <up|down|status>
+
+  up      apply every pending schema migration
+  down    revert the latest applied migrations (see -steps)
+  status  list the migrations and when they were applied
+
+flags:
+`
+
+func runMigrate(args []string) {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+	var dbUrl *string = flags.String("db", os.Getenv(settings.EnvName("db")), "URL to connect to database (see `gecko -h`); also $"+settings.EnvName("db"))
+	var steps *int = flags.Int("steps", 1, "number of migrations to revert with `down`")
+
+	command := migrateCommand(flags, args)
+
+	db, err := openDB(settings.Storage{URL: *dbUrl})
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		applied, err := gecko.MigrateUp(db)
+		if err != nil {
+			logger.Fatalf("Migration failed: %v", err)
+		}
+		for _, migration := range applied {
+			logger.Printf("applied %04d_%s", migration.Version, migration.Name)
+		}
+		if len(applied) == 0 {
+			logger.Println("schema is up to date")
+		}
+	case "down":
+		reverted, err := gecko.MigrateDown(db, *steps)
+		if err != nil {
+			logger.Fatalf("Migration failed: %v", err)
+		}
+		for _, migration := range reverted {
+			logger.Printf("reverted %04d_%s", migration.Version, migration.Name)
+		}
+		if len(reverted) == 0 {
+			logger.Println("no applied migrations to revert")
+		}
+	case "status":
+		statuses, err := gecko.MigrationStatuses(db)
+		if err != nil {
+			logger.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-32s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// migrateCommand parses args, which can have flags both before and after the
+// subcommand, and returns the subcommand, or "" when there isn't exactly one.
+func migrateCommand(flags *flag.FlagSet, args []string) string {
+	if flags.Parse(args) != nil || flags.NArg() == 0 {
+		return ""
+	}
+	command := flags.Arg(0)
+	if flags.Parse(flags.Args()[1:]) != nil || flags.NArg() > 0 {
+		return ""
+	}
+	return command
+}
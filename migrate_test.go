@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateCommand(t *testing.T) {
+	cases := []struct {
+		args    []string
+		command string
+		db      string
+		steps   int
+	}{
+		{args: []string{"up", "-db", "sqlite://a.db"}, command: "up", db: "sqlite://a.db", steps: 1},
+		{args: []string{"-db", "sqlite://a.db", "up"}, command: "up", db: "sqlite://a.db", steps: 1},
+		{args: []string{"-db", "sqlite://a.db", "down", "-steps", "2"}, command: "down", db: "sqlite://a.db", steps: 2},
+		{args: []string{"status"}, command: "status", steps: 1},
+		{args: []string{}, steps: 1},
+		{args: []string{"-db", "sqlite://a.db"}, db: "sqlite://a.db", steps: 1},
+		{args: []string{"up", "down"}, steps: 1},
+		{args: []string{"up", "-unknown"}, steps: 1},
+	}
+	for _, c := range cases {
+		flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		db := flags.String("db", "", "")
+		steps := flags.Int("steps", 1, "")
+		assert.Equal(t, c.command, migrateCommand(flags, c.args), "%v", c.args)
+		assert.Equal(t, c.db, *db, "%v", c.args)
+		assert.Equal(t, c.steps, *steps, "%v", c.args)
+	}
+}
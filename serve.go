@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko"
+	"github.com/ACED-IDP/gecko/gecko/settings"
+)
+
+// newHTTPServer returns the server for handler with the limits from the
+// settings, and the function that starts it, with TLS when it is configured.
+func newHTTPServer(config *settings.Settings, handler http.Handler, errorLog *slog.Logger) (*http.Server, func() error) {
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", config.Server.Port),
+		ReadTimeout:       config.Server.ReadTimeout,
+		ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+		MaxHeaderBytes:    config.Server.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(errorLog.Handler(), slog.LevelError),
+		Handler:           handler,
+	}
+	listen := httpServer.ListenAndServe
+	if config.TLS.Enabled() {
+		httpServer.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if config.TLS.MinVersion == settings.TLSVersion13 {
+			httpServer.TLSConfig.MinVersion = tls.VersionTLS13
+		}
+		listen = func() error {
+			return httpServer.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile)
+		}
+	}
+	return httpServer, listen
+}
+
+// shutdown is how serve winds down once its context is done.
+type shutdown struct {
+	// drainDelay is how long requests keep being served after the readiness
+	// probe started failing.
+	drainDelay time.Duration
+	// grace is how long the requests in flight then get to finish.
+	grace time.Duration
+	// cleanup runs once no request is being served any more, to stop the
+	// background jobs, flush traces and close the database.
+	cleanup func()
+}
+
+// serve runs httpServer, started by listen, until ctx is done, then shuts it
+// down without cutting off requests in flight. The readiness probe fails right
+// away, but requests keep being served for the drain delay, which gives load
+// balancers time to stop sending new ones. The server then stops accepting
+// connections and waits up to the grace period for the requests it has to
+// finish. The cleanup runs last, also when the server failed.
+func serve(ctx context.Context, logger *slog.Logger, httpServer *http.Server, listen func() error, geckoServer *gecko.Server, plan shutdown) error {
+	if plan.cleanup != nil {
+		defer plan.cleanup()
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down", "drain_delay", plan.drainDelay.String(), "grace_period", plan.grace.String())
+	geckoServer.Drain()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(plan.drainDelay):
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), plan.grace)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Warn("grace period over, closing the remaining connections")
+		err = httpServer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ACED-IDP/gecko/gecko"
+	"github.com/ACED-IDP/gecko/gecko/settings"
+	"github.com/ACED-IDP/gecko/tests/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
+)
+
+// startServe runs serve on a free port with a `/slow` route that answers once
+// release is closed. It returns the base URL, a channel that receives each
+// `/slow` request as it starts, the function that triggers the shutdown and a
+// channel that receives the error serve returns.
+func startServe(t *testing.T, plan shutdown, release chan struct{}) (string, chan struct{}, context.CancelFunc, chan error) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	geckoServer := gecko.NewServer().
+		WithLogger(logger).
+		WithJWTApp(authutils.NewJWTApplication(fixtures.NewJWKS(t).URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithStore(gecko.NewMemoryStore())
+	router := geckoServer.MakeRouter()
+	started := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})
+	mux.Handle("/", router)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	httpServer := &http.Server{Handler: mux}
+	listen := func() error { return httpServer.Serve(listener) }
+	ctx, stop := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve(ctx, logger, httpServer, listen, geckoServer, plan)
+	}()
+	return "http://" + listener.Addr().String(), started, stop, errs
+}
+
+func TestServeDrains(t *testing.T) {
+	release := make(chan struct{})
+	cleanedUp := make(chan struct{})
+	plan := shutdown{drainDelay: 300 * time.Millisecond, grace: 5 * time.Second, cleanup: func() { close(cleanedUp) }}
+	baseURL, started, stop, errs := startServe(t, plan, release)
+
+	resp, err := http.Get(baseURL + "/_status/ready")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	slow := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		assert.NoError(t, err)
+		slow <- resp
+	}()
+	<-started
+	stop()
+
+	// During the drain delay the readiness probe fails, but requests are
+	// still served.
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + "/_status/ready")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, plan.drainDelay, 10*time.Millisecond)
+
+	// The request in flight gets to finish, and the cleanup waits for it.
+	select {
+	case <-cleanedUp:
+		t.Fatal("cleaned up with a request in flight")
+	case <-time.After(plan.drainDelay):
+	}
+	close(release)
+	resp = <-slow
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+	resp.Body.Close()
+
+	assert.NoError(t, <-errs)
+	<-cleanedUp
+	_, err = http.Get(baseURL + "/_status/live")
+	assert.Error(t, err)
+}
+
+func TestServeGracePeriod(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cleanedUp := false
+	plan := shutdown{grace: 200 * time.Millisecond, cleanup: func() { cleanedUp = true }}
+	baseURL, started, stop, errs := startServe(t, plan, release)
+
+	slow := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		slow <- err
+	}()
+	<-started
+	stopped := time.Now()
+	stop()
+
+	// The request never finishes, so the server closes its connection once
+	// the grace period is over.
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the grace period")
+	}
+	assert.GreaterOrEqual(t, time.Since(stopped), plan.grace)
+	assert.True(t, cleanedUp)
+	assert.Error(t, <-slow)
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	flags := []string{
+		"-port", "9090",
+		"-read-timeout", "11s",
+		"-read-header-timeout", "2s",
+		"-write-timeout", "13s",
+		"-idle-timeout", "14s",
+		"-max-header-bytes", "4096",
+	}
+	flagSet := flag.NewFlagSet("gecko", flag.ContinueOnError)
+	config, err := settings.Load(flagSet, flags, func(string) (string, bool) { return "", false })
+	assert.NoError(t, err)
+	httpServer, _ := newHTTPServer(config, http.NotFoundHandler(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Equal(t, ":9090", httpServer.Addr)
+	assert.Equal(t, 11*time.Second, httpServer.ReadTimeout)
+	assert.Equal(t, 2*time.Second, httpServer.ReadHeaderTimeout)
+	assert.Equal(t, 13*time.Second, httpServer.WriteTimeout)
+	assert.Equal(t, 14*time.Second, httpServer.IdleTimeout)
+	assert.Equal(t, 4096, httpServer.MaxHeaderBytes)
+	assert.Nil(t, httpServer.TLSConfig)
+}
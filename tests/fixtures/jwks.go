@@ -0,0 +1,74 @@
+package fixtures
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// JWKS serves a one-key JWKS and signs tokens with the matching private key,
+// standing in for fence in tests.
+type JWKS struct {
+	server *httptest.Server
+	signer jose.Signer
+}
+
+func NewJWKS(t *testing.T) *JWKS {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &privateKey.PublicKey,
+		KeyID:     "test",
+		Algorithm: "RS256",
+		Use:       "sig",
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keySet)
+	}))
+	t.Cleanup(server.Close)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: privateKey},
+		&jose.SignerOptions{ExtraHeaders: map[jose.HeaderKey]any{"kid": "test"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &JWKS{server: server, signer: signer}
+}
+
+// URL is the endpoint to pass to authutils.NewJWTApplication.
+func (jwks *JWKS) URL() string {
+	return jwks.server.URL
+}
+
+// Token returns a fence-style access token for username expiring at exp.
+func (jwks *JWKS) Token(t *testing.T, username string, exp time.Time) string {
+	claims := map[string]any{
+		"sub": "42",
+		"exp": exp.Unix(),
+		"context": map[string]any{
+			"user": map[string]any{"name": username},
+		},
+	}
+	token, err := jwt.Signed(jwks.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// AllowAll is an authorizer that permits every action.
+type AllowAll struct{}
+
+func (AllowAll) Authorize(token string, resource string, action string) (bool, error) {
+	return true, nil
+}
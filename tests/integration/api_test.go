@@ -3,22 +3,85 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/ACED-IDP/gecko/gecko"
 	"github.com/ACED-IDP/gecko/gecko/config"
 	"github.com/ACED-IDP/gecko/tests/fixtures"
 	"github.com/stretchr/testify/assert"
+	"github.com/uc-cdis/go-authutils/authutils"
 )
 
-func makeRequest(method, url string, payload []byte) *http.Request {
-	req, _ := http.NewRequest(method, url, bytes.NewBuffer(payload))
+// baseURL and token are set up by startServer for every test.
+var (
+	baseURL string
+	token   string
+)
+
+// startServer runs gecko in-process. It uses a MemoryStore unless
+// $GECKO_TEST_DB points at a migrated Postgres or SQLite database.
+func startServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	jwks := fixtures.NewJWKS(t)
+	server := gecko.NewServer().
+		WithLogger(logger).
+		WithJWTApp(authutils.NewJWTApplication(jwks.URL())).
+		WithAuthorizer(fixtures.AllowAll{}).
+		WithAnonymousReads(true)
+	if dbUrl := os.Getenv("GECKO_TEST_DB"); dbUrl != "" {
+		db, err := gecko.OpenDB(dbUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		server = server.WithDB(db)
+	} else {
+		server = server.WithStore(gecko.NewMemoryStore())
+	}
+	server, err := server.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.MakeRouter())
+	t.Cleanup(httpServer.Close)
+	baseURL = httpServer.URL
+	token = jwks.Token(t, "tester", time.Now().Add(time.Hour))
+}
+
+func makeRequest(method, path string, payload []byte) *http.Request {
+	req, _ := http.NewRequest(method, baseURL+path, bytes.NewBuffer(payload))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 	return req
 }
 
+// uniqueConfigID returns a config ID no earlier test or test run has used, so
+// that tests sharing a database through $GECKO_TEST_DB see only their own
+// versions.
+func uniqueConfigID(name string) string {
+	return fmt.Sprintf("%s%d", name, time.Now().UnixNano())
+}
+
+func testConfigPayload(t *testing.T) []byte {
+	var configs []config.ConfigItem
+	err := json.Unmarshal([]byte(fixtures.TestConfig), &configs)
+	assert.NoError(t, err)
+	payloadBytes, err := json.Marshal(configs)
+	assert.NoError(t, err)
+	return payloadBytes
+}
+
 func TestHealthCheck(t *testing.T) {
-	resp, err := http.DefaultClient.Do(makeRequest("GET", "http://localhost:8080/health", nil))
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("GET", "/health", nil))
 	assert.NoError(t, err)
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(resp.Body)
@@ -27,7 +90,36 @@ func TestHealthCheck(t *testing.T) {
 	assert.Contains(t, body, "Healthy")
 }
 
+func TestStatusProbes(t *testing.T) {
+	startServer(t)
+	resp, err := http.Get(baseURL + "/_status/live")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get(baseURL + "/_status/ready")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var ready struct {
+		Status string `json:"status"`
+		Checks []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"checks"`
+	}
+	decodeBody(t, resp, &ready)
+	assert.Equal(t, "ok", ready.Status)
+	names := []string{}
+	for _, check := range ready.Checks {
+		names = append(names, check.Name)
+		assert.Equal(t, "ok", check.Status, check.Name)
+	}
+	assert.Contains(t, names, "database")
+	assert.Contains(t, names, "jwks")
+}
+
 func TestHandleConfigPUT(t *testing.T) {
+	startServer(t)
 	var configs []config.ConfigItem
 	err := json.Unmarshal([]byte(fixtures.TestConfig), &configs)
 	t.Log("CONFIGS: ", configs)
@@ -35,7 +127,7 @@ func TestHandleConfigPUT(t *testing.T) {
 	marshalledJSON, err := json.Marshal(configs)
 	assert.NoError(t, err)
 
-	resp, err := http.DefaultClient.Do(makeRequest("PUT", "http://localhost:8080/config/123", marshalledJSON))
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/123", marshalledJSON))
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	defer resp.Body.Close()
@@ -56,7 +148,8 @@ func TestHandleConfigPUT(t *testing.T) {
 }
 
 func TestHandleConfigPUTInvalidJson(t *testing.T) {
-	resp, err := http.DefaultClient.Do(makeRequest("PUT", "http://localhost:8080/config/123", []byte("invalid json")))
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/123", []byte("invalid json")))
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	defer resp.Body.Close()
@@ -80,9 +173,10 @@ func TestHandleConfigPUTInvalidJson(t *testing.T) {
 }
 
 func TestHandleConfigPUTInvalidObject(t *testing.T) {
+	startServer(t)
 	marshalledJSON, err := json.Marshal(map[string]any{"foo": "bar"})
 	assert.NoError(t, err)
-	resp, err := http.DefaultClient.Do(makeRequest("PUT", "http://localhost:8080/config/123", marshalledJSON))
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/123", marshalledJSON))
 
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
@@ -107,16 +201,17 @@ func TestHandleConfigPUTInvalidObject(t *testing.T) {
 }
 
 func TestHandleConfigGET(t *testing.T) {
+	startServer(t)
 	var configs []config.ConfigItem
 	err := json.Unmarshal([]byte(fixtures.TestConfig), &configs)
 
 	payloadBytes, err := json.Marshal(configs)
 	assert.NoError(t, err)
 
-	_, err = http.DefaultClient.Do(makeRequest("PUT", "http://localhost:8080/config/123", payloadBytes))
+	_, err = http.DefaultClient.Do(makeRequest("PUT", "/config/123", payloadBytes))
 	assert.NoError(t, err)
 
-	resp, err := http.DefaultClient.Do(makeRequest("GET", "http://localhost:8080/config/123", nil))
+	resp, err := http.DefaultClient.Do(makeRequest("GET", "/config/123", nil))
 	assert.NoError(t, err)
 
 	buf := new(bytes.Buffer)
@@ -134,30 +229,613 @@ func TestHandleConfigGET(t *testing.T) {
 }
 
 func TestHandle404ConfigGet(t *testing.T) {
-	resp, err := http.DefaultClient.Do(makeRequest("GET", "http://localhost:8080/config/404config", nil))
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("GET", "/config/404config", nil))
 	assert.NoError(t, err)
 	assert.Equal(t, resp.StatusCode, 404)
 }
 
 func TestHandle404ConfigDelete(t *testing.T) {
-	resp, err := http.DefaultClient.Do(makeRequest("DELETE", "http://localhost:8080/config/404config", nil))
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("DELETE", "/config/404config", nil))
 	assert.NoError(t, err)
 	assert.Equal(t, resp.StatusCode, 404)
 }
 
 func TestHandleConfigDeleteOK(t *testing.T) {
+	startServer(t)
 	var configs []config.ConfigItem
 	err := json.Unmarshal([]byte(fixtures.TestConfig), &configs)
 	payloadBytes, err := json.Marshal(configs)
 	assert.NoError(t, err)
-	_, err = http.DefaultClient.Do(makeRequest("PUT", "http://localhost:8080/config/testdelete", payloadBytes))
+	_, err = http.DefaultClient.Do(makeRequest("PUT", "/config/testdelete", payloadBytes))
 	assert.NoError(t, err)
 
-	resp, err := http.DefaultClient.Do(makeRequest("DELETE", "http://localhost:8080/config/testdelete", nil))
+	resp, err := http.DefaultClient.Do(makeRequest("DELETE", "/config/testdelete", nil))
 	assert.NoError(t, err)
 	assert.Equal(t, resp.StatusCode, 200)
 
-	resp, err = http.DefaultClient.Do(makeRequest("GET", "http://localhost:8080/config/testdelete", nil))
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/testdelete", nil))
 	assert.NoError(t, err)
 	assert.Equal(t, resp.StatusCode, 404)
 }
+
+func decodeBody(t *testing.T, resp *http.Response, out any) {
+	defer resp.Body.Close()
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+}
+
+func TestHandleConfigPUTWithoutToken(t *testing.T) {
+	startServer(t)
+	req := makeRequest("PUT", "/config/123", testConfigPayload(t))
+	req.Header.Del("Authorization")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestConfigVersionsAndRollback(t *testing.T) {
+	startServer(t)
+	payload := testConfigPayload(t)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/versioned", payload))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var configs []config.ConfigItem
+	assert.NoError(t, json.Unmarshal(payload, &configs))
+	configs[0].TabTitle = "changed"
+	changed, err := json.Marshal(configs)
+	assert.NoError(t, err)
+	resp, err = http.DefaultClient.Do(makeRequest("PUT", "/config/versioned", changed))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/versioned/versions", nil))
+	assert.NoError(t, err)
+	var versions []map[string]any
+	decodeBody(t, resp, &versions)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, float64(2), versions[0]["version"])
+	assert.Equal(t, "tester", versions[0]["author"])
+
+	resp, err = http.DefaultClient.Do(makeRequest("POST", "/config/versioned/rollback/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var rolledBack map[string]any
+	decodeBody(t, resp, &rolledBack)
+	assert.Equal(t, float64(3), rolledBack["version"])
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/versioned", nil))
+	assert.NoError(t, err)
+	var outData map[string]any
+	decodeBody(t, resp, &outData)
+	tabs := outData["content"].([]any)
+	assert.Equal(t, "test", tabs[0].(map[string]any)["tabTitle"])
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/versioned/versions/9", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestConfigConditionalRequests(t *testing.T) {
+	startServer(t)
+	payload := testConfigPayload(t)
+
+	req := makeRequest("PUT", "/config/conditional", payload)
+	req.Header.Set("If-None-Match", "*")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	req = makeRequest("PUT", "/config/conditional", payload)
+	req.Header.Set("If-None-Match", "*")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/conditional", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	req = makeRequest("GET", "/config/conditional", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	req = makeRequest("DELETE", "/config/conditional", nil)
+	req.Header.Set("If-Match", `"stale"`)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	req = makeRequest("DELETE", "/config/conditional", nil)
+	req.Header.Set("If-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestConfigList(t *testing.T) {
+	startServer(t)
+	payload := testConfigPayload(t)
+	for _, name := range []string{"list-a", "list-b", "list-c", "other"} {
+		resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/"+name, payload))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	var page struct {
+		Configs    []map[string]any `json:"configs"`
+		NextCursor string           `json:"nextCursor"`
+	}
+	resp, err := http.DefaultClient.Do(makeRequest("GET", "/config?prefix=list-&limit=2", nil))
+	assert.NoError(t, err)
+	decodeBody(t, resp, &page)
+	assert.Len(t, page.Configs, 2)
+	assert.Equal(t, "list-a", page.Configs[0]["name"])
+	assert.Equal(t, float64(1), page.Configs[0]["tabs"])
+	assert.Equal(t, []any{"file"}, page.Configs[0]["dataTypes"])
+	assert.NotEmpty(t, page.NextCursor)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config?prefix=list-&limit=2&cursor="+page.NextCursor, nil))
+	assert.NoError(t, err)
+	page.Configs = nil
+	decodeBody(t, resp, &page)
+	assert.Len(t, page.Configs, 1)
+	assert.Equal(t, "list-c", page.Configs[0]["name"])
+	assert.Empty(t, page.NextCursor)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config?dataType=patient", nil))
+	assert.NoError(t, err)
+	page.Configs = nil
+	decodeBody(t, resp, &page)
+	assert.Empty(t, page.Configs)
+}
+
+func TestHandleConfigPUTInvalidConfig(t *testing.T) {
+	startServer(t)
+	var configs []config.ConfigItem
+	assert.NoError(t, json.Unmarshal(testConfigPayload(t), &configs))
+	configs[0].GuppyConfig.DataType = ""
+	configs[0].Table.Fields = append(configs[0].Table.Fields, "project_code")
+	payload, err := json.Marshal(configs)
+	assert.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/invalid", payload))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var errData map[string]any
+	decodeBody(t, resp, &errData)
+	details := errData["error"].(map[string]any)["details"].([]any)
+	assert.Equal(t, []any{
+		map[string]any{"path": "[0].guppyConfig.dataType", "message": "dataType is required"},
+		map[string]any{"path": "[0].table.columns.project_code", "message": `table field "project_code" has no columns entry`},
+	}, details)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/invalid", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHandleConfigPUTUnknownFields(t *testing.T) {
+	startServer(t)
+	var configs []map[string]any
+	assert.NoError(t, json.Unmarshal(testConfigPayload(t), &configs))
+	configs[0]["filter"] = map[string]any{"tabs": []any{}}
+	configs[0]["guppyConfig"].(map[string]any)["futureFlag"] = true
+	payload, err := json.Marshal(configs)
+	assert.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/extras?strict=true", payload))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var errData map[string]any
+	decodeBody(t, resp, &errData)
+	details := errData["error"].(map[string]any)["details"].([]any)
+	assert.Equal(t, []any{"[0].guppyConfig.futureFlag", "[0].filter"}, details)
+
+	// Without strict decoding the unknown properties are kept.
+	resp, err = http.DefaultClient.Do(makeRequest("PUT", "/config/extras", payload))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/extras", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stored map[string]any
+	decodeBody(t, resp, &stored)
+	var expected []any
+	assert.NoError(t, json.Unmarshal(payload, &expected))
+	assert.Equal(t, expected, stored["content"])
+}
+
+func TestSchemaGET(t *testing.T) {
+	startServer(t)
+	resp, err := http.Get(baseURL + "/schema/explorer-config")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var schema map[string]any
+	decodeBody(t, resp, &schema)
+	assert.Equal(t, config.SchemaDialect, schema["$schema"])
+	assert.Contains(t, schema["$defs"], "ConfigItem")
+}
+
+func TestHandleConfigPUTSchemaViolation(t *testing.T) {
+	startServer(t)
+	var configs []map[string]any
+	assert.NoError(t, json.Unmarshal(testConfigPayload(t), &configs))
+	delete(configs[0], "guppyConfig")
+	configs[0]["charts"].(map[string]any)["a"].(map[string]any)["chartType"] = "scatter"
+	// a problem only Validate finds is listed along with the schema's
+	table := configs[0]["table"].(map[string]any)
+	table["fields"] = append(table["fields"].([]any), "project_code")
+	payload, err := json.Marshal(configs)
+	assert.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/schema", payload))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var errData map[string]any
+	decodeBody(t, resp, &errData)
+	paths := []any{}
+	for _, problem := range errData["error"].(map[string]any)["details"].([]any) {
+		paths = append(paths, problem.(map[string]any)["path"])
+	}
+	assert.Equal(t, []any{"[0].guppyConfig", "[0].charts.a.chartType", "[0].table.columns.project_code"}, paths)
+}
+
+func makePatchRequest(path string, contentType string, patch string) *http.Request {
+	req := makeRequest("PATCH", path, []byte(patch))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestHandleConfigPATCH(t *testing.T) {
+	startServer(t)
+	path := "/config/" + uniqueConfigID("patched")
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", path, testConfigPayload(t)))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	resp.Body.Close()
+
+	jsonPatch := `[
+		{"op": "test", "path": "/0/tabTitle", "value": "test"},
+		{"op": "replace", "path": "/0/table/columns/b/title", "value": "B"}
+	]`
+	req := makePatchRequest(path, "application/json-patch+json", jsonPatch)
+	req.Header.Set("If-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	resp.Body.Close()
+
+	// The ETag changed, so the same request now fails its precondition.
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp.Body.Close()
+
+	// A merge patch replaces the config as a whole, since it is an array.
+	var configs []map[string]any
+	assert.NoError(t, json.Unmarshal(testConfigPayload(t), &configs))
+	configs[0]["tabTitle"] = "merged"
+	mergePatch, err := json.Marshal(configs)
+	assert.NoError(t, err)
+	resp, err = http.DefaultClient.Do(makePatchRequest(path, "application/merge-patch+json", string(mergePatch)))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", path, nil))
+	assert.NoError(t, err)
+	var stored gecko.StoredConfig
+	decodeBody(t, resp, &stored)
+	assert.Equal(t, "merged", stored.Content[0].TabTitle)
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", path+"/versions", nil))
+	assert.NoError(t, err)
+	var versions []gecko.DocumentVersion
+	decodeBody(t, resp, &versions)
+	assert.Len(t, versions, 3)
+}
+
+func TestHandleConfigPATCHErrors(t *testing.T) {
+	startServer(t)
+	path := "/config/" + uniqueConfigID("patcherrors")
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", path, testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		patch       string
+		status      int
+	}{
+		{"missing config", "/config/missing", "application/json-patch+json", `[]`, http.StatusNotFound},
+		{"unsupported format", path, "application/json", `[]`, http.StatusUnsupportedMediaType},
+		{"invalid patch", path, "application/json-patch+json", `[{"op": "nope", "path": ""}]`, http.StatusBadRequest},
+		{"failed test", path, "application/json-patch+json", `[{"op": "test", "path": "/0/tabTitle", "value": "other"}]`, http.StatusConflict},
+		{"invalid result", path, "application/json-patch+json", `[{"op": "remove", "path": "/0/guppyConfig/dataType"}]`, http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(makePatchRequest(c.path, c.contentType, c.patch))
+			assert.NoError(t, err)
+			assert.Equal(t, c.status, resp.StatusCode)
+			resp.Body.Close()
+		})
+	}
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", path+"/versions", nil))
+	assert.NoError(t, err)
+	var versions []gecko.DocumentVersion
+	decodeBody(t, resp, &versions)
+	assert.Len(t, versions, 1)
+}
+
+func TestConfigTabs(t *testing.T) {
+	startServer(t)
+	var tabs []map[string]any
+	assert.NoError(t, json.Unmarshal(testConfigPayload(t), &tabs))
+	tab := tabs[0]
+	tab["tabTitle"] = "File"
+	tabJSON := func(title string) []byte {
+		tab["tabTitle"] = title
+		data, err := json.Marshal(tab)
+		assert.NoError(t, err)
+		return data
+	}
+	payload, err := json.Marshal([]any{tab})
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/tabs", payload))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("POST", "/config/tabs/tabs?position=0", tabJSON("Patient")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/config/tabs/tabs/Patient", resp.Header.Get("Location"))
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("POST", "/config/tabs/tabs", tabJSON("Patient")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	// Only the File tab changes, and unknown properties are kept.
+	tab["table"].(map[string]any)["enabled"] = false
+	tab["futureFlag"] = true
+	resp, err = http.DefaultClient.Do(makeRequest("PUT", "/config/tabs/tabs/File", tabJSON("File")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("PUT", "/config/tabs/tabs/File", tabJSON("Other")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/tabs/tabs/File", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var file map[string]any
+	decodeBody(t, resp, &file)
+	assert.Equal(t, false, file["table"].(map[string]any)["enabled"])
+	assert.Equal(t, true, file["futureFlag"])
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/tabs", nil))
+	assert.NoError(t, err)
+	var stored gecko.StoredConfig
+	decodeBody(t, resp, &stored)
+	assert.Len(t, stored.Content, 2)
+	assert.Equal(t, "Patient", stored.Content[0].TabTitle)
+	assert.True(t, stored.Content[0].Table.Enabled)
+	assert.Equal(t, "File", stored.Content[1].TabTitle)
+
+	resp, err = http.DefaultClient.Do(makeRequest("DELETE", "/config/tabs/tabs/Patient", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	for _, path := range []string{"/config/tabs/tabs/Patient", "/config/missing/tabs/File"} {
+		resp, err = http.DefaultClient.Do(makeRequest("GET", path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+		resp.Body.Close()
+	}
+	resp, err = http.DefaultClient.Do(makeRequest("DELETE", "/config/tabs/tabs/Patient", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestConfigDiff(t *testing.T) {
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/staging", testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("PUT", "/config/production", testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	retitle := `[{"op": "replace", "path": "/0/table/columns/b/title", "value": "B"}]`
+	resp, err = http.DefaultClient.Do(makePatchRequest("/config/staging", "application/json-patch+json", retitle))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	expected := map[string]any{
+		"from": "production",
+		"to":   "staging",
+		"patch": []any{
+			map[string]any{"op": "replace", "path": "/0/table/columns/b/title", "value": "B"},
+		},
+		"summary": []any{`tab "test": column "b" retitled from "asd" to "B"`},
+	}
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/production/diff/staging", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var diff map[string]any
+	decodeBody(t, resp, &diff)
+	assert.Equal(t, expected, diff)
+
+	expected["from"], expected["to"] = "staging@1", "staging@2"
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/staging/versions/1/diff/2", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	decodeBody(t, resp, &diff)
+	assert.Equal(t, expected, diff)
+
+	for _, path := range []string{"/config/production/diff/missing", "/config/staging/versions/1/diff/3"} {
+		resp, err = http.DefaultClient.Do(makeRequest("GET", path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+		resp.Body.Close()
+	}
+}
+
+func TestConfigTrash(t *testing.T) {
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/trashed", testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/trashed", nil))
+	assert.NoError(t, err)
+	var stored gecko.StoredConfig
+	decodeBody(t, resp, &stored)
+	assert.NotZero(t, stored.ID)
+	assert.NotZero(t, stored.Version)
+	assert.NotEmpty(t, stored.UpdatedBy)
+	assert.False(t, stored.CreatedAt.IsZero())
+
+	resp, err = http.DefaultClient.Do(makeRequest("DELETE", "/config/trashed", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var deleted struct {
+		Config gecko.StoredConfig `json:"config"`
+	}
+	decodeBody(t, resp, &deleted)
+	assert.Equal(t, "trashed", deleted.Config.Name)
+	assert.Equal(t, stored.Version, deleted.Config.Version)
+	assert.Equal(t, stored.Content[0].TabTitle, deleted.Config.Content[0].TabTitle)
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/trashed", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/trash", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var trash struct {
+		Configs []gecko.TrashedConfig `json:"configs"`
+	}
+	decodeBody(t, resp, &trash)
+	names := []string{}
+	for _, trashed := range trash.Configs {
+		names = append(names, trashed.Name)
+	}
+	assert.Contains(t, names, "trashed")
+
+	resp, err = http.Get(baseURL + "/trash")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("POST", "/config/trashed/restore", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/trashed", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("DELETE", "/config/trashed?hard=true", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("POST", "/config/trashed/restore", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestVersion(t *testing.T) {
+	startServer(t)
+	resp, err := http.Get(baseURL + "/_version")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var info struct {
+		GoVersion     string `json:"goVersion"`
+		Storage       string `json:"storage"`
+		SchemaVersion *int   `json:"schemaVersion"`
+	}
+	decodeBody(t, resp, &info)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	if os.Getenv("GECKO_TEST_DB") == "" {
+		assert.Equal(t, "memory", info.Storage)
+		assert.Nil(t, info.SchemaVersion)
+	} else if assert.NotNil(t, info.SchemaVersion) {
+		latest, err := gecko.LatestSchemaVersion(info.Storage)
+		assert.NoError(t, err)
+		assert.Equal(t, latest, *info.SchemaVersion)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	startServer(t)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/measured", testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/config/measured", nil))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.Get(baseURL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	metrics := string(body)
+	assert.Contains(t, metrics, `gecko_http_requests_total{method="PUT",route="/config/{configId}",status="200"} 1`)
+	assert.Contains(t, metrics, `gecko_http_requests_total{method="GET",route="/config/{configId}",status="200"} 1`)
+	assert.Contains(t, metrics, `gecko_http_request_duration_seconds_bucket{method="GET",route="/config/{configId}",status="200"`)
+	assert.Contains(t, metrics, "gecko_config_put_body_bytes_count 1")
+	assert.Contains(t, metrics, "gecko_panics_recovered_total 0")
+}
+
+func TestAudit(t *testing.T) {
+	startServer(t)
+	since := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	resp, err := http.DefaultClient.Do(makeRequest("PUT", "/config/audited", testConfigPayload(t)))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.DefaultClient.Do(makeRequest("DELETE", "/config/audited", nil))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(makeRequest("GET", "/audit?configId=audited&actor=tester&since="+since, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var page struct {
+		Events []gecko.AuditEvent `json:"events"`
+	}
+	decodeBody(t, resp, &page)
+	if assert.Len(t, page.Events, 2) {
+		put, deleted := page.Events[0], page.Events[1]
+		assert.Equal(t, gecko.AuditActionPut, put.Action)
+		assert.Equal(t, gecko.AuditActionDelete, deleted.Action)
+		assert.Equal(t, put.AfterHash, deleted.BeforeHash)
+		assert.Empty(t, deleted.AfterHash)
+		assert.Equal(t, "127.0.0.1", deleted.SourceIP)
+		assert.NotEmpty(t, deleted.RequestID)
+	}
+
+	resp, err = http.Get(baseURL + "/audit")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
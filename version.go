@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ACED-IDP/gecko/gecko/version"
+)
+
+const versionUsage = `usage: gecko version [flags]
+
+Print the version of gecko and how it was built.
+
+flags:
+`
+
+func runVersion(args []string) {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), versionUsage)
+		flags.PrintDefaults()
+	}
+	var asJSON *bool = flags.Bool("json", false, "print the build information as JSON, as served by GET /_version")
+	_ = flags.Parse(args)
+
+	info := version.Get()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(info)
+		return
+	}
+	unknown := func(value string) string {
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	}
+	fmt.Printf("gecko %s\n", unknown(info.GitVersion))
+	fmt.Printf("commit: %s\n", unknown(info.GitCommit))
+	fmt.Printf("built:  %s\n", unknown(info.BuildTime))
+	fmt.Printf("go:     %s\n", info.GoVersion)
+}